@@ -0,0 +1,38 @@
+package main
+
+import "math"
+
+// Fraction (0-1) of ambient light reaching scene point p, which isn't blocked
+// by surface around it. Points of hemisphere above surface at p are sampled,
+// more of them near its normal, every one under surface blocks part of light.
+// Normal is taken from heightfield, so that samples don't go below surface
+// because of its sampling.
+func (s *Scene) ambientOcclusion(heights *heightField, p Vec) float64 {
+	if heights == nil || !s.ao || s.aoSamples < 1 {
+		return 1
+	}
+	n, ok := heights.normal(p.x, p.y)
+	if !ok {
+		return 1
+	}
+	tangent := normalize(crossProduct(n, Vec{0, 1, 0}))
+	bitangent := crossProduct(n, tangent)
+
+	occluded := 0
+	for i := 0; i < s.aoSamples; i++ {
+		t := (float64(i) + 0.5) / float64(s.aoSamples)
+		r := math.Sqrt(t)
+		angle := float64(i) * goldenAngle
+		direction := add3(mult(r*math.Cos(angle), tangent), mult(r*math.Sin(angle), bitangent), mult(math.Sqrt(1-t), n))
+		// distances are spread over radius independently of directions
+		distance := s.aoRadius * (0.2 + 0.8*math.Mod(float64(i)*goldenAngle/(2*math.Pi), 1))
+		q := add(p, mult(distance, direction))
+		// height difference within cell is tolerated, the same as for
+		// nearest sample of heightfield
+		height, ok := heights.at(q.x, q.y)
+		if ok && height > q.z+heightFieldCell {
+			occluded++
+		}
+	}
+	return 1 - s.aoStrength*float64(occluded)/float64(s.aoSamples)
+}
@@ -0,0 +1,234 @@
+package main
+
+import "math"
+
+func init() {
+	RegisterBRDF("phong", "Phong", func(scene *Scene) BRDF {
+		return &phongBRDF{scene: scene}
+	})
+	RegisterBRDF("blinn-phong", "Blinn-Phong", func(scene *Scene) BRDF {
+		return &blinnPhongBRDF{scene: scene}
+	})
+	RegisterBRDF("oren-nayar", "Oren-Nayar", func(scene *Scene) BRDF {
+		return &orenNayarBRDF{scene: scene, roughness: 0.5}
+	})
+	RegisterBRDF("cook-torrance", "Cook-Torrance", func(scene *Scene) BRDF {
+		return &cookTorranceBRDF{scene: scene, roughness: 0.5, metallic: 0, f0: 0.04}
+	})
+}
+
+// Reflectance model of surface material
+type BRDF interface {
+	// Fractions of light coming from direction l, which are reflected
+	// diffusely and specularly towards viewer in direction v by surface
+	// with normal n (all normalized), falloff with cos(n, l) is included.
+	// Diffuse light takes color of object.
+	Reflect(n, l, v Vec) (diffuse, specular float64)
+	// How much specular light takes color of object (0-1), 0 gives white
+	// highlights
+	SpecularTint() float64
+}
+
+// Implemented by reflectance models with highlights controlled by ks and m
+// coefficients of scene, menu shows their sliders only for these models
+type ExponentSpecular interface {
+	exponentSpecular()
+}
+
+// Implemented by reflectance models lit by environment. Gives fractions of
+// environment irradiance reflected diffusely and of radiance coming from
+// reflection direction reflected specularly towards viewer in direction v
+// by surface with normal n, and roughness (0-1) choosing blur of reflection.
+type EnvironmentBRDF interface {
+	ReflectEnvironment(n, v Vec) (diffuse, specular, roughness float64)
+}
+
+type brdfEntry struct {
+	name    string
+	label   string
+	newBRDF func(scene *Scene) BRDF
+}
+
+// Registered reflectance models, in order of registration
+var brdfRegistry = []brdfEntry{}
+
+// Register new reflectance model, name is used internally, label is shown in
+// menu. Should be called from init function of file implementing the model.
+func RegisterBRDF(name, label string, newBRDF func(scene *Scene) BRDF) {
+	for _, entry := range brdfRegistry {
+		if entry.name == name {
+			panic("BRDF " + name + " is already registered")
+		}
+	}
+	brdfRegistry = append(brdfRegistry, brdfEntry{name, label, newBRDF})
+}
+
+// Create instance of every registered reflectance model for scene, models
+// read coefficients shared by all of them (kd, ks, m) from scene
+func newBRDFs(scene *Scene) map[string]BRDF {
+	brdfs := map[string]BRDF{}
+	for _, entry := range brdfRegistry {
+		brdfs[entry.name] = entry.newBRDF(scene)
+	}
+	return brdfs
+}
+
+func clampedDot(vec0, vec1 Vec) float64 {
+	return math.Max(dotProduct(vec0, vec1), 0)
+}
+
+// Lambertian diffuse with specular highlight depending on angle between
+// viewer and reflected light direction. Highlights take color of object, as
+// they always did in this application.
+type phongBRDF struct {
+	scene *Scene
+}
+
+func (b *phongBRDF) exponentSpecular() {}
+
+func (b *phongBRDF) SpecularTint() float64 {
+	return 1
+}
+
+// Roughness of Phong exponent m, for which highlights have similar size
+func phongRoughness(m float64) float64 {
+	return math.Sqrt(2 / (m + 2))
+}
+
+func (b *phongBRDF) ReflectEnvironment(n, v Vec) (float64, float64, float64) {
+	return b.scene.kd, b.scene.ks, phongRoughness(b.scene.m)
+}
+
+func (b *phongBRDF) Reflect(n, l, v Vec) (float64, float64) {
+	r := normalize(minus(mult(2*dotProduct(n, l), n), l))
+	return b.scene.kd * clampedDot(n, l), b.scene.ks * math.Pow(clampedDot(v, r), b.scene.m)
+}
+
+// Phong with highlight depending on angle between normal and half vector of
+// light and viewer directions
+type blinnPhongBRDF struct {
+	scene *Scene
+}
+
+func (b *blinnPhongBRDF) exponentSpecular() {}
+
+func (b *blinnPhongBRDF) SpecularTint() float64 {
+	return 1
+}
+
+// Blinn-Phong exponent is about four times larger than Phong one giving the
+// same highlights
+func (b *blinnPhongBRDF) ReflectEnvironment(n, v Vec) (float64, float64, float64) {
+	return b.scene.kd, b.scene.ks, phongRoughness(b.scene.m / 4)
+}
+
+func (b *blinnPhongBRDF) Reflect(n, l, v Vec) (float64, float64) {
+	h := normalize(add(l, v))
+	specular := 0.0
+	if dotProduct(n, l) > 0 {
+		specular = b.scene.ks * math.Pow(clampedDot(n, h), b.scene.m)
+	}
+	return b.scene.kd * clampedDot(n, l), specular
+}
+
+// Diffuse reflection from rough surface made of tiny Lambertian facets,
+// roughness is standard deviation of facet angle in radians
+type orenNayarBRDF struct {
+	scene     *Scene
+	roughness float64
+}
+
+func (b *orenNayarBRDF) Params() []Param {
+	return []Param{
+		{Name: "roughness", Min: 0, Max: 1, Step: 0.01, Value: &b.roughness},
+	}
+}
+
+func (b *orenNayarBRDF) SpecularTint() float64 {
+	return 1
+}
+
+// Irradiance is reflected as by Lambertian surface, without dependence on
+// roughness
+func (b *orenNayarBRDF) ReflectEnvironment(n, v Vec) (float64, float64, float64) {
+	return b.scene.kd, 0, 1
+}
+
+func (b *orenNayarBRDF) Reflect(n, l, v Vec) (float64, float64) {
+	cosNL := clampedDot(n, l)
+	cosNV := clampedDot(n, v)
+	if cosNL == 0 {
+		return 0, 0
+	}
+	sigma2 := b.roughness * b.roughness
+	coefA := 1 - 0.5*sigma2/(sigma2+0.33)
+	coefB := 0.45 * sigma2 / (sigma2 + 0.09)
+
+	// cosine of azimuth between light and viewer around normal
+	lt := minus(l, mult(dotProduct(n, l), n))
+	vt := minus(v, mult(dotProduct(n, v), n))
+	cosPhi := 0.0
+	if magnitude(lt) > 1e-9 && magnitude(vt) > 1e-9 {
+		cosPhi = math.Max(dotProduct(normalize(lt), normalize(vt)), 0)
+	}
+	thetaL := math.Acos(cosNL)
+	thetaV := math.Acos(cosNV)
+	alpha := math.Max(thetaL, thetaV)
+	beta := math.Min(thetaL, thetaV)
+
+	return b.scene.kd * cosNL * (coefA + coefB*cosPhi*math.Sin(alpha)*math.Tan(beta)), 0
+}
+
+// Microfacet model with GGX distribution, Smith geometry term and Schlick
+// Fresnel approximation. Metals have no diffuse reflection and their
+// highlights take color of object.
+type cookTorranceBRDF struct {
+	scene     *Scene
+	roughness float64
+	metallic  float64
+	f0        float64 // reflectance at normal incidence of dielectrics
+}
+
+func (b *cookTorranceBRDF) Params() []Param {
+	return []Param{
+		{Name: "roughness", Min: 0.05, Max: 1, Step: 0.01, Value: &b.roughness},
+		{Name: "metallic", Min: 0, Max: 1, Step: 0.01, Value: &b.metallic},
+		{Name: "F0", Min: 0, Max: 1, Step: 0.01, Value: &b.f0},
+	}
+}
+
+func (b *cookTorranceBRDF) SpecularTint() float64 {
+	return b.metallic
+}
+
+// Fresnel term at viewing angle, with rough surfaces reflecting less at
+// grazing angles, as microfacets face different directions
+func (b *cookTorranceBRDF) ReflectEnvironment(n, v Vec) (float64, float64, float64) {
+	f0 := b.f0*(1-b.metallic) + b.metallic
+	f := f0 + (math.Max(1-b.roughness, f0)-f0)*math.Pow(1-clampedDot(n, v), 5)
+	return b.scene.kd * (1 - b.metallic) * (1 - f), f, b.roughness
+}
+
+func (b *cookTorranceBRDF) Reflect(n, l, v Vec) (float64, float64) {
+	cosNL := clampedDot(n, l)
+	cosNV := clampedDot(n, v)
+	if cosNL == 0 || cosNV == 0 {
+		return 0, 0
+	}
+	h := normalize(add(l, v))
+	cosNH := clampedDot(n, h)
+	cosVH := clampedDot(v, h)
+
+	alpha2 := math.Pow(b.roughness, 4)
+	d := alpha2 / math.Pow(cosNH*cosNH*(alpha2-1)+1, 2) / math.Pi
+	k := (b.roughness + 1) * (b.roughness + 1) / 8
+	g := cosNL / (cosNL*(1-k) + k) * cosNV / (cosNV*(1-k) + k)
+	f0 := b.f0*(1-b.metallic) + b.metallic
+	f := f0 + (1-f0)*math.Pow(1-cosVH, 5)
+
+	// diffuse reflection isn't divided by pi in this application, so
+	// specular one is multiplied by it to keep them in proportion
+	specular := math.Pi * d * g * f / (4 * cosNV)
+	diffuse := b.scene.kd * (1 - b.metallic) * (1 - f) * cosNL
+	return diffuse, specular
+}
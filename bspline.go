@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Uniform knot vector for count control points of given degree, surface
+// domain doesn't reach first and last control points
+func uniformKnots(count, degree int) []float64 {
+	knots := make([]float64, count+degree+1)
+	for i := range knots {
+		knots[i] = float64(i)
+	}
+	return knots
+}
+
+// Clamped (open) uniform knot vector for count control points of given
+// degree, surface interpolates control points at its edges
+func clampedKnots(count, degree int) []float64 {
+	knots := make([]float64, count+degree+1)
+	for i := range knots {
+		if i <= degree {
+			knots[i] = 0
+		} else if i >= count {
+			knots[i] = float64(count - degree)
+		} else {
+			knots[i] = float64(i - degree)
+		}
+	}
+	return knots
+}
+
+func validateKnots(knots []float64, count, degree int) error {
+	if len(knots) != count+degree+1 {
+		return fmt.Errorf("knot vector needs %d values, got %d", count+degree+1, len(knots))
+	}
+	for i := 1; i < len(knots); i++ {
+		if knots[i] < knots[i-1] {
+			return errors.New("knot vector must be non-decreasing")
+		}
+	}
+	if knots[degree] >= knots[count] {
+		return errors.New("knot vector domain is empty")
+	}
+	return nil
+}
+
+// Parse comma separated knot vector, e.g. "0, 0, 0, 1, 2, 2, 2"
+func parseKnots(text string) ([]float64, error) {
+	knots := []float64{}
+	for _, field := range strings.Split(text, ",") {
+		knot, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, err
+		}
+		knots = append(knots, knot)
+	}
+	return knots, nil
+}
+
+func formatKnots(knots []float64) string {
+	fields := make([]string, len(knots))
+	for i, knot := range knots {
+		fields[i] = strconv.FormatFloat(knot, 'g', -1, 64)
+	}
+	return strings.Join(fields, ", ")
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+// Values and derivatives of all B-spline basis functions of given degree at
+// t, calculated with Cox-de Boor recursion formula
+func bsplineBasis(t float64, degree int, knots []float64) ([]float64, []float64) {
+	count := len(knots) - degree - 1
+
+	N := make([]float64, len(knots)-1)
+	for i := range N {
+		if knots[i] <= t && t < knots[i+1] {
+			N[i] = 1
+		}
+	}
+
+	prev := N
+	for d := 1; d <= degree; d++ {
+		prev = N
+		N = make([]float64, len(knots)-1-d)
+		for i := range N {
+			N[i] = ratio(t-knots[i], knots[i+d]-knots[i])*prev[i] +
+				ratio(knots[i+d+1]-t, knots[i+d+1]-knots[i+1])*prev[i+1]
+		}
+	}
+
+	dN := make([]float64, count)
+	if degree > 0 {
+		for i := range dN {
+			dN[i] = float64(degree) * (ratio(prev[i], knots[i+degree]-knots[i]) -
+				ratio(prev[i+1], knots[i+degree+1]-knots[i+1]))
+		}
+	}
+
+	return N[:count], dN
+}
+
+// Map t from 0-1 onto knot vector domain, return mapped value and length of
+// domain (needed to scale derivatives)
+func knotsDomain(t float64, degree int, knots []float64) (float64, float64) {
+	count := len(knots) - degree - 1
+	a := knots[degree]
+	b := knots[count]
+	t = a + t*(b-a)
+	// basis functions are defined on half-open intervals, so move end of
+	// domain slightly inside
+	if t >= b {
+		t = b - (b-a)*1e-9
+	}
+	return t, b - a
+}
+
+// Evaluate NURBS surface at (u, v), return point and partial derivatives
+// with respect to u and v. With nil pointsWeight it is a B-spline surface.
+func nurbs(u, v float64, pointsHeight, pointsWeight [][]float64, knotsU, knotsV []float64, degree int) (Vec, Vec, Vec) {
+	tu, lengthU := knotsDomain(u, degree, knotsU)
+	tv, lengthV := knotsDomain(v, degree, knotsV)
+	Nu, dNu := bsplineBasis(tu, degree, knotsU)
+	Nv, dNv := bsplineBasis(tv, degree, knotsV)
+
+	// sums of weighted heights (A) and weights (W) with their derivatives
+	A, Au, Av := 0.0, 0.0, 0.0
+	W, Wu, Wv := 0.0, 0.0, 0.0
+	for i := range pointsHeight {
+		if Nu[i] == 0 && dNu[i] == 0 {
+			continue
+		}
+		for j := range pointsHeight[i] {
+			w := 1.0
+			if pointsWeight != nil {
+				w = pointsWeight[i][j]
+			}
+			h := pointsHeight[i][j] / 100
+			A += Nu[i] * Nv[j] * w * h
+			Au += dNu[i] * Nv[j] * w * h
+			Av += Nu[i] * dNv[j] * w * h
+			W += Nu[i] * Nv[j] * w
+			Wu += dNu[i] * Nv[j] * w
+			Wv += Nu[i] * dNv[j] * w
+		}
+	}
+
+	z := ratio(A, W)
+	zu := ratio(Au-z*Wu, W) * lengthU
+	zv := ratio(Av-z*Wv, W) * lengthV
+
+	return Vec{u, v, z}, Vec{1, 0, zu}, Vec{0, 1, zv}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"math"
+
+	"github.com/goki/mat32"
+)
+
+// Camera projections
+const (
+	projectionOrthographic = iota
+	projectionPerspective
+)
+
+// Zoom limits of camera
+const (
+	zoomMin = 0.1
+	zoomMax = 10
+)
+
+// Camera orbiting around raster centre moved by pan, alpha is rotation around
+// vertical axis and beta is tilt from top-down view. Scene points are in
+// raster coordinates with height in the same units as light height (surface
+// height multiplied by 100), the same as in calcColor.
+type camera struct {
+	viewProjection *mat32.Mat4
+	inverse        *mat32.Mat4
+	perspective    bool
+	eye            Vec
+	direction      Vec     // from target to eye, normalized
+	right          Vec     // scene direction pointing right on image
+	up             Vec     // scene direction pointing up on image
+	width          float64 // size of image camera renders to
+	height         float64
+}
+
+// Raster y axis points down, so height axis is flipped to make coordinates
+// right-handed, as mat32 expects (works for both points and directions)
+func cameraVec(p Vec) mat32.Vec3 {
+	return mat32.Vec3{X: float32(p.x), Y: float32(p.y), Z: float32(-p.z)}
+}
+
+func sceneVec(v mat32.Vec3) Vec {
+	return Vec{float64(v.X), float64(v.Y), -float64(v.Z)}
+}
+
+// Camera rendering scene into width x height image. With default view
+// (orthographic, no rotation, pan and zoom) raster is scaled to fit image
+// without changing its proportions and placed in its centre.
+func (s *Scene) camera(width, height int) *camera {
+	rasterWidth := float64(s.config.UI.RasterWidth)
+	rasterHeight := float64(s.config.UI.RasterHeight)
+	size := math.Max(rasterWidth, rasterHeight)
+	// part of scene plane seen by camera has proportions of image and is
+	// large enough to hold raster in both directions
+	aspect := float64(width) / float64(height)
+	viewHeight := math.Max(rasterHeight, rasterWidth/aspect)
+	target := add(Vec{rasterWidth / 2, rasterHeight / 2, 0}, s.pan)
+
+	sinAlpha, cosAlpha := math.Sincos(s.alpha)
+	sinBeta, cosBeta := math.Sincos(s.beta)
+	direction := Vec{sinBeta * sinAlpha, sinBeta * cosAlpha, cosBeta}
+	// up is derivative of direction by -beta, so it is never parallel to
+	// direction and is -y (up on raster) for top-down view
+	up := Vec{-cosBeta * sinAlpha, -cosBeta * cosAlpha, sinBeta}
+	right := crossProduct(direction, up)
+
+	// perspective camera is placed so that raster fits image, orthographic
+	// one only has to be above the surface
+	distance := 4 * size
+	if s.projection == projectionPerspective {
+		distance = viewHeight / 2 / math.Tan(s.fov*math.Pi/360) / s.zoom
+	}
+	eye := add(target, mult(distance, direction))
+
+	world := mat32.NewMat4()
+	world.LookAt(cameraVec(eye), cameraVec(target), cameraVec(up))
+	world.SetPos(cameraVec(eye))
+	view, _ := world.Inverse()
+
+	near := float32(1)
+	far := float32(distance + 4*size)
+	projection := mat32.NewMat4()
+	if s.projection == projectionPerspective {
+		projection.SetPerspective(float32(s.fov), float32(aspect), near, far)
+	} else {
+		projection.SetOrthographic(float32(viewHeight*aspect/s.zoom), float32(viewHeight/s.zoom), near, far)
+	}
+
+	viewProjection := mat32.NewMat4()
+	viewProjection.MulMatrices(projection, view)
+	inverse, _ := viewProjection.Inverse()
+
+	return &camera{
+		viewProjection: viewProjection,
+		inverse:        inverse,
+		perspective:    s.projection == projectionPerspective,
+		eye:            eye,
+		direction:      direction,
+		right:          right,
+		up:             up,
+		width:          float64(width),
+		height:         float64(height),
+	}
+}
+
+// Project scene point onto image, returns image point with depth (-1 at near
+// plane, 1 at far plane) as z and w coordinate needed for perspective correct
+// interpolation. ok is false if point is behind camera.
+func (c *camera) project(p Vec) (Vec, float64, bool) {
+	clip := mat32.NewVec4FromVec3(cameraVec(p), 1).MulMat4(c.viewProjection)
+	if clip.W <= 1e-6 {
+		return Vec{}, 0, false
+	}
+	return Vec{
+		(float64(clip.X/clip.W) + 1) / 2 * c.width,
+		(1 - float64(clip.Y/clip.W)) / 2 * c.height,
+		float64(clip.Z / clip.W),
+	}, float64(clip.W), true
+}
+
+// Raster point (x, y) at given height seen at image point (px, py), ok is
+// false if ray from camera doesn't hit plane of that height
+func (c *camera) unproject(px, py, height float64) (float64, float64, bool) {
+	ndcX := float32(2*px/c.width - 1)
+	ndcY := float32(1 - 2*py/c.height)
+	near := sceneVec(mat32.NewVec4(ndcX, ndcY, -1, 1).MulMat4(c.inverse).PerspDiv())
+	far := sceneVec(mat32.NewVec4(ndcX, ndcY, 1, 1).MulMat4(c.inverse).PerspDiv())
+	if math.Abs(far.z-near.z) < 1e-9 {
+		return 0, 0, false
+	}
+	t := (height - near.z) / (far.z - near.z)
+	if t < 0 {
+		return 0, 0, false
+	}
+	p := add(near, mult(t, minus(far, near)))
+	return p.x, p.y, true
+}
+
+// Normalized direction from scene point to viewer
+func (c *camera) viewDirection(p Vec) Vec {
+	if c.perspective {
+		return normalize(minus(c.eye, p))
+	}
+	return c.direction
+}
+
+// Distance of scene point from camera along view direction, used as depth of
+// pixels showing it
+func (c *camera) depth(p Vec) float64 {
+	return dotProduct(minus(c.eye, p), c.direction)
+}
+
+// Camera orientation, position and zoom, changed together by dragging and
+// recorded in history as single edit
+type viewState struct {
+	alpha float64
+	beta  float64
+	pan   Vec
+	zoom  float64
+}
+
+func (s *Scene) view() viewState {
+	return viewState{s.alpha, s.beta, s.pan, s.zoom}
+}
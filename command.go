@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+	"github.com/zeraye/bezier-shading/pkg/scenefile"
+)
+
+// Commands running without window, chosen by first argument
+var commands = map[string]func(config *config.Config, args []string) error{
+	"render": renderCommand,
+	"mesh":   meshCommand,
+}
+
+// Render scene file to image without opening window, e.g.
+// bezier-shading render --scene s.toml --out frame.png --size 1024x1024
+func renderCommand(config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	scenePath := flags.String("scene", "", "scene file to render")
+	outPath := flags.String("out", "frame.png", "rendered image file")
+	size := flags.String("size", fmt.Sprintf("%dx%d", config.UI.RasterWidth, config.UI.RasterHeight), "rendered image size (WxH)")
+	samples := flags.Int("samples", 1, "supersampling, every pixel is average of samples x samples rendered pixels")
+	quality := flags.Int("quality", config.Defaults.JPEGQuality, "JPEG quality (1-100)")
+	depth := flags.Int("depth", 8, "bits per channel of PNG and TIFF images (8 or 16)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *scenePath == "" {
+		return errors.New("scene file is required (--scene)")
+	}
+
+	width, height, err := parseSize(*size)
+	if err != nil {
+		return err
+	}
+	if *samples < 1 {
+		return fmt.Errorf("invalid supersampling %d", *samples)
+	}
+	if *quality < 1 || *quality > 100 {
+		return fmt.Errorf("invalid JPEG quality %d", *quality)
+	}
+	if *depth != 8 && *depth != 16 {
+		return fmt.Errorf("invalid bits per channel %d", *depth)
+	}
+	format, err := imageFormatFromPath(*outPath, *depth == 16)
+	if err != nil {
+		return err
+	}
+
+	file, err := scenefile.LoadFile(*scenePath)
+	if err != nil {
+		return err
+	}
+	scene := NewScene(config)
+	err = scene.loadSceneFile(file, *scenePath)
+	if err != nil {
+		return err
+	}
+
+	if isHDRImageFormat(format) {
+		img := scene.RenderHDRSupersampled(width, height, *samples)
+		return saveHDRImageToFilePath(*outPath, img, format)
+	}
+	img := scene.RenderSupersampled(width, height, *samples)
+	return saveImageToFilePath(*outPath, img, format, *quality)
+}
+
+// Export surface mesh of scene file without opening window, e.g.
+// bezier-shading mesh --scene s.toml --out surface.obj --triangulation 20
+func meshCommand(config *config.Config, args []string) error {
+	flags := flag.NewFlagSet("mesh", flag.ContinueOnError)
+	scenePath := flags.String("scene", "", "scene file to export")
+	outPath := flags.String("out", "surface.obj", "mesh file (.obj, .stl, .ply or .glb)")
+	triangulation := flags.Int("triangulation", 0, "number of squares at the side of control points grid cell (default from scene)")
+	ascii := flags.Bool("ascii", false, "write ASCII instead of binary STL")
+	light := flags.Bool("light", false, "export light to glTF file")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *scenePath == "" {
+		return errors.New("scene file is required (--scene)")
+	}
+	if *triangulation < 0 {
+		return fmt.Errorf("invalid triangulation %d", *triangulation)
+	}
+	format, err := meshFormatFromPath(*outPath, *ascii)
+	if err != nil {
+		return err
+	}
+
+	file, err := scenefile.LoadFile(*scenePath)
+	if err != nil {
+		return err
+	}
+	scene := NewScene(config)
+	err = scene.loadSceneFile(file, *scenePath)
+	if err != nil {
+		return err
+	}
+	if *triangulation == 0 {
+		*triangulation = scene.triangulation
+	}
+
+	return scene.saveMeshToFilePath(*outPath, *triangulation, format, *light)
+}
+
+// Parse image size written as WxH, e.g. 1024x768
+func parseSize(text string) (int, int, error) {
+	var width, height int
+	_, err := fmt.Sscanf(text, "%dx%d", &width, &height)
+	if err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid size %q, expected WxH", text)
+	}
+	return width, height, nil
+}
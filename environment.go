@@ -0,0 +1,198 @@
+package main
+
+import (
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zeraye/bezier-shading/pkg/draw"
+	"github.com/zeraye/bezier-shading/pkg/hdr"
+)
+
+const (
+	// Width of sharpest reflection level, environment images are scaled
+	// down to it
+	environmentWidth = 256
+	// Width of blurred reflection levels and of image they are computed from
+	environmentBlurredWidth = 64
+	// Width of irradiance map
+	environmentIrradianceWidth = 32
+	// Number of reflection levels, for roughness from 0 to 1
+	environmentLevels = 5
+)
+
+// Light coming to surface from all directions, loaded from equirectangular
+// image (longitude along x, zenith at top). It is prefiltered when loaded, so
+// that lighting is looked up instead of integrated at every pixel.
+type environment struct {
+	// cosine weighted average of radiance over hemisphere around normal
+	irradiance *hdr.Image
+	// radiance blurred around reflection direction for roughness from 0 to 1
+	reflections []*hdr.Image
+}
+
+// Load environment from Radiance HDR (.hdr) or ordinary image file
+func loadEnvironment(filePath string) (*environment, error) {
+	if strings.ToLower(filepath.Ext(filePath)) != ".hdr" {
+		img, err := getImageFromFilePath(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return newEnvironment(imageRadiance(img)), nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := hdr.Decode(f)
+	if err != nil {
+		return nil, err
+	}
+	return newEnvironment(img), nil
+}
+
+// Radiance of ordinary image, sRGB encoded channels are decoded to linear
+// light in 0-1
+func imageRadiance(img image.Image) *hdr.Image {
+	bounds := img.Bounds()
+	radiance := hdr.NewImage(bounds.Dx(), bounds.Dy())
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			r, g, b := draw.ColorLinearRGB(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			radiance.SetRGB(x, y, r, g, b)
+		}
+	}
+	return radiance
+}
+
+func newEnvironment(img *hdr.Image) *environment {
+	sharp := scaleEnvironment(img, environmentWidth)
+	blurred := scaleEnvironment(sharp, environmentBlurredWidth)
+
+	e := &environment{reflections: []*hdr.Image{sharp}}
+	for level := 1; level < environmentLevels; level++ {
+		// Phong lobe with exponent giving similar highlights as roughness
+		roughness := float64(level) / (environmentLevels - 1)
+		exponent := 2/(roughness*roughness) - 2
+		e.reflections = append(e.reflections, convolveEnvironment(blurred, environmentBlurredWidth, exponent))
+	}
+	e.irradiance = convolveEnvironment(blurred, environmentIrradianceWidth, 1)
+	return e
+}
+
+// Equirectangular image scaled down to width (and half of it height) by
+// averaging pixels, images which are already small are only resampled
+func scaleEnvironment(img *hdr.Image, width int) *hdr.Image {
+	height := width / 2
+	scaled := hdr.NewImage(width, height)
+	for y := 0; y < height; y++ {
+		y0, y1 := y*img.Height/height, max((y+1)*img.Height/height, y*img.Height/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*img.Width/width, max((x+1)*img.Width/width, x*img.Width/width+1)
+			sum := Vec{}
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b := img.RGB(sx, sy)
+					sum = add(sum, Vec{r, g, b})
+				}
+			}
+			sum = mult(1/float64((x1-x0)*(y1-y0)), sum)
+			scaled.SetRGB(x, y, sum.x, sum.y, sum.z)
+		}
+	}
+	return scaled
+}
+
+// Average of radiance of img weighted by cos^exponent of angle from direction
+// of every pixel of result (width x width/2), over hemisphere around it
+func convolveEnvironment(img *hdr.Image, width int, exponent float64) *hdr.Image {
+	height := width / 2
+	directions := make([]Vec, img.Width*img.Height)
+	solidAngles := make([]float64, img.Width*img.Height)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			u, v := (float64(x)+0.5)/float64(img.Width), (float64(y)+0.5)/float64(img.Height)
+			directions[y*img.Width+x] = environmentDirection(u, v)
+			// pixels get smaller towards poles
+			solidAngles[y*img.Width+x] = math.Sin(math.Pi * v)
+		}
+	}
+
+	result := hdr.NewImage(width, height)
+	parallel(height, func(y int) {
+		for x := 0; x < width; x++ {
+			d := environmentDirection((float64(x)+0.5)/float64(width), (float64(y)+0.5)/float64(height))
+			sum, weights := Vec{}, 0.0
+			for i, direction := range directions {
+				cos := dotProduct(d, direction)
+				if cos <= 0 {
+					continue
+				}
+				weight := math.Pow(cos, exponent) * solidAngles[i]
+				r, g, b := img.RGB(i%img.Width, i/img.Width)
+				sum = add(sum, mult(weight, Vec{r, g, b}))
+				weights += weight
+			}
+			sum = mult(1/weights, sum)
+			result.SetRGB(x, y, sum.x, sum.y, sum.z)
+		}
+	})
+	return result
+}
+
+// Direction of point (u, v) of equirectangular image, in scene coordinates
+// with z axis up
+func environmentDirection(u, v float64) Vec {
+	phi, theta := 2*math.Pi*u, math.Pi*v
+	return Vec{math.Sin(theta) * math.Cos(phi), math.Sin(theta) * math.Sin(phi), math.Cos(theta)}
+}
+
+// Point of equirectangular image in direction d, environment rotated by
+// rotation (in radians) around vertical axis
+func environmentUV(d Vec, rotation float64) (float64, float64) {
+	phi := math.Atan2(d.y, d.x) - rotation
+	u := phi / (2 * math.Pi)
+	u -= math.Floor(u)
+	v := math.Acos(math.Max(-1, math.Min(d.z, 1))) / math.Pi
+	return u, v
+}
+
+// Bilinear sample of img at (u, v), wrapped around horizontally
+func sampleEnvironment(img *hdr.Image, u, v float64) Vec {
+	x := u*float64(img.Width) - 0.5
+	y := math.Max(0, math.Min(v*float64(img.Height)-0.5, float64(img.Height-1)))
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	x1, y1 := x0+1, min(y0+1, img.Height-1)
+	x0, x1 = (x0+img.Width)%img.Width, x1%img.Width
+
+	rgb := func(x, y int) Vec {
+		r, g, b := img.RGB(x, y)
+		return Vec{r, g, b}
+	}
+	top := add(mult(1-fx, rgb(x0, y0)), mult(fx, rgb(x1, y0)))
+	bottom := add(mult(1-fx, rgb(x0, y1)), mult(fx, rgb(x1, y1)))
+	return add(mult(1-fy, top), mult(fy, bottom))
+}
+
+// Irradiance of surface with normal n, divided by pi, so that uniform
+// environment with radiance 1 lights surface like head-on light with
+// intensity 1
+func (e *environment) irradianceAt(n Vec, rotation float64) Vec {
+	u, v := environmentUV(n, rotation)
+	return sampleEnvironment(e.irradiance, u, v)
+}
+
+// Radiance coming from direction r, blurred according to roughness (0-1)
+func (e *environment) reflectionAt(r Vec, roughness, rotation float64) Vec {
+	u, v := environmentUV(r, rotation)
+	level := math.Max(0, math.Min(roughness, 1)) * (environmentLevels - 1)
+	level0 := int(level)
+	level1 := min(level0+1, environmentLevels-1)
+	t := level - float64(level0)
+	return add(mult(1-t, sampleEnvironment(e.reflections[level0], u, v)), mult(t, sampleEnvironment(e.reflections[level1], u, v)))
+}
@@ -1,192 +1,252 @@
 package main
 
 import (
-	"cmp"
 	"image"
 	"image/color"
 	"math"
-	"slices"
 	"sync"
 
-	"github.com/goki/mat32"
 	"github.com/zeraye/bezier-shading/pkg/draw"
 	"github.com/zeraye/bezier-shading/pkg/geom"
 )
 
-func mod(value, mod int) int {
-	if value < 0 {
-		return value + mod
-	}
-	return value
+// Polygon projected onto image, with surface evaluated at its vertices
+type projectedPolygon struct {
+	points []*geom.Point
+	n_arr  []Vec
+	z_arr  []float64
+	pixels []*geom.Point
+	// perspective correct barycentric weights of vertices, as functions of
+	// image point
+	edge_arr []edgeFunction
+	// light reflected from vertices for Gouraud shading, from whole polygon
+	// for flat shading
+	light_arr []reflectedLight
 }
 
-func FillPolygon(points []*geom.Point, color color.Color, img *image.RGBA, g *Game, wg *sync.WaitGroup) {
-	defer wg.Done()
-
+// Project polygon with scene coordinates points, where surface is evaluated
+// as surface, by camera, nil if there is nothing to fill
+func projectPolygon(points []*geom.Point, surface []SurfacePoint, s *Scene, cam *camera, heights *heightField) *projectedPolygon {
 	if len(points) < 3 {
-		return
+		return nil
 	}
 
-	ind := make([]int, len(points))
-	for i := 0; i < len(points); i++ {
-		ind[i] = i
+	n_arr := make([]Vec, 0, len(points))
+	z_arr := make([]float64, 0, len(points))
+	for _, sp := range surface {
+		n_arr = append(n_arr, sp.Normal)
+		z_arr = append(z_arr, sp.Z)
 	}
-	slices.SortFunc(ind, func(i, j int) int {
-		return cmp.Compare(points[i].Y, points[j].Y)
-	})
-
-	n_arr := []Vec{}
-	z_arr := []float64{}
-	for i := 0; i < len(points); i++ {
-		if g.surface == "bezier" {
-			ndu := bezierDU(points[i].X/float64(g.config.UI.RasterWidth), points[i].Y/float64(g.config.UI.RasterHeight), g.pointsHeight)
-			ndv := bezierDV(points[i].X/float64(g.config.UI.RasterWidth), points[i].Y/float64(g.config.UI.RasterHeight), g.pointsHeight)
-			n_arr = append(n_arr, normalize(crossProduct(ndu, ndv)))
-			z_arr = append(z_arr, bezier(points[i].X/float64(g.config.UI.RasterWidth), points[i].Y/float64(g.config.UI.RasterHeight), g.pointsHeight).z)
-		} else {
-			width := float64(g.config.UI.RasterWidth)
-			r := width / 2
-			if math.Pow(points[i].X-r, 2)+math.Pow(-points[i].Y+r, 2) < math.Pow(r, 2) {
-				z := math.Sqrt(
-					math.Pow(0.5, 2) -
-						math.Pow(points[i].X/width-0.5, 2) -
-						math.Pow(points[i].Y/width-0.5, 2))
-				n_arr = append(n_arr, normalize(Vec{
-					points[i].X/width - 0.5, points[i].Y/width - 0.5, z,
-				}))
-				z_arr = append(z_arr, z)
-			} else {
-				n_arr = append(n_arr, normalize(Vec{0, 0, 1}))
-				z_arr = append(z_arr, 0)
-			}
 
+	pixels := make([]*geom.Point, len(points))
+	w_arr := make([]float64, len(points))
+	for i, p := range points {
+		pixel, w, ok := cam.project(Vec{p.X, p.Y, z_arr[i] * 100})
+		if !ok {
+			// polygon behind camera isn't clipped, just skipped
+			return nil
 		}
+		pixels[i] = geom.NewPoint(pixel.x, pixel.y)
+		w_arr[i] = w
 	}
 
-	ymin := points[ind[0]].Y
-	ymax := points[ind[len(points)-1]].Y
-	aet := []*geom.Segment{}
-
-	for y := ymin; y < ymax; y++ {
-		for k := range ind[:len(ind)-1] {
-			if points[ind[k]].Y == y {
-				curr := points[ind[k]]
-				prev := points[mod(ind[k]-1, len(points))]
-				next := points[mod(ind[k]+1, len(points))]
-				if prev.Y >= curr.Y {
-					aet = append(aet, geom.NewSegment(prev, curr))
-				} else {
-					// remove (prev, curr from aet)
-					for i, seg := range aet {
-						if *seg == *geom.NewSegment(prev, curr) {
-							aet[i] = aet[len(aet)-1]
-							aet = aet[:len(aet)-1]
-							break
-						}
-					}
-				}
-				if next.Y >= curr.Y {
-					aet = append(aet, geom.NewSegment(next, curr))
-				} else {
-					// remove (next, curr from aet)
-					for i, seg := range aet {
-						if *seg == *geom.NewSegment(next, curr) {
-							aet[i] = aet[len(aet)-1]
-							aet = aet[:len(aet)-1]
-							break
-						}
-					}
-				}
+	edge_arr, ok := perspectiveEdges(pixels, w_arr)
+	if !ok {
+		return nil
+	}
+
+	polygon := &projectedPolygon{points: points, n_arr: n_arr, z_arr: z_arr, pixels: pixels, edge_arr: edge_arr}
+	switch s.shading {
+	case shadingFlat:
+		// lit at centroid with average normal
+		third := 1 / float64(len(points))
+		x, y, z := 0.0, 0.0, 0.0
+		n := Vec{}
+		for i, p := range points {
+			x += p.X * third
+			y += p.Y * third
+			z += z_arr[i] * third
+			n = add(n, n_arr[i])
+		}
+		polygon.light_arr = []reflectedLight{calcLight(s, cam, heights, x, y, z, normalize(n), s.normalMapVec(x, y))}
+	case shadingGouraud:
+		for i, p := range points {
+			polygon.light_arr = append(polygon.light_arr, calcLight(s, cam, heights, p.X, p.Y, z_arr[i], n_arr[i], s.normalMapVec(p.X, p.Y)))
+		}
+	}
+	return polygon
+}
+
+// Pixels which polygon may cover, limited to rectangle r
+func (p *projectedPolygon) bounds(r image.Rectangle) image.Rectangle {
+	xmin, ymin := math.Inf(1), math.Inf(1)
+	xmax, ymax := math.Inf(-1), math.Inf(-1)
+	for _, pixel := range p.pixels {
+		xmin = math.Min(xmin, pixel.X)
+		ymin = math.Min(ymin, pixel.Y)
+		xmax = math.Max(xmax, pixel.X)
+		ymax = math.Max(ymax, pixel.Y)
+	}
+	// limited before conversion, projected points may be far off image
+	xmin = math.Max(math.Floor(xmin), float64(r.Min.X))
+	ymin = math.Max(math.Floor(ymin), float64(r.Min.Y))
+	xmax = math.Min(math.Ceil(xmax)+1, float64(r.Max.X))
+	ymax = math.Min(math.Ceil(ymax)+1, float64(r.Max.Y))
+	if xmin >= xmax || ymin >= ymax {
+		return image.Rectangle{}
+	}
+	return image.Rect(int(xmin), int(ymin), int(xmax), int(ymax))
+}
+
+// Fill pixels of polygon inside clip rectangle, mesh outline is drawn at
+// edges of whole polygon, not clip
+func (p *projectedPolygon) fill(color color.Color, buffer *draw.DepthBuffer, s *Scene, cam *camera, heights *heightField, clip image.Rectangle) {
+	points, n_arr, z_arr, pixels := p.points, p.n_arr, p.z_arr, p.pixels
+	e0, e1, e2 := p.edge_arr[0], p.edge_arr[1], p.edge_arr[2]
+
+	ymin := pixels[0].Y
+	ymax := pixels[0].Y
+	for _, p := range pixels {
+		ymin = math.Min(ymin, p.Y)
+		ymax = math.Max(ymax, p.Y)
+	}
+	ymin = math.Max(math.Ceil(ymin), float64(buffer.Bounds().Min.Y))
+	ymax = math.Min(ymax, float64(buffer.Bounds().Max.Y))
+
+	for py := math.Max(ymin, float64(clip.Min.Y)); py < math.Min(ymax, float64(clip.Max.Y)); py++ {
+		// projected triangle is convex, so scanline crosses it in one span
+		// between the leftmost and rightmost edge crossing it
+		xl, xr := math.Inf(1), math.Inf(-1)
+		for k := range pixels {
+			curr := pixels[k]
+			next := pixels[(k+1)%len(pixels)]
+			if (curr.Y <= py && py < next.Y) || (next.Y <= py && py < curr.Y) {
+				x := curr.X + (py-curr.Y)*((next.X-curr.X)/(next.Y-curr.Y))
+				xl = math.Min(xl, x)
+				xr = math.Max(xr, x)
 			}
 		}
-		slices.SortFunc(aet, func(s0, s1 *geom.Segment) int {
-			return cmp.Compare(s0.P0.X, s1.P0.X)
-		})
-
-		for i := 0; i < len(aet)/2; i++ {
-			x0 := getX(y, *aet[i])
-			x1 := getX(y, *aet[i+1])
-			for x := x0; x < x1; x++ {
-				var normalmapVec *Vec = nil
-
-				if !g.isBackgroundSolidColor && g.backgroundImage != nil {
-					color = g.backgroundImage.At(int(x), int(y))
-				}
-				if g.normalMap != nil {
-					normalmapVec = getNormalVecFromColor(g.normalMap.At(int(x), int(y)))
+
+		if xl <= xr {
+			x0 := math.Ceil(xl)
+			x1 := math.Min(xr, float64(clip.Max.X))
+			// edge functions are linear, so they are stepped along scanline
+			start := math.Max(x0, math.Max(float64(buffer.Bounds().Min.X), float64(clip.Min.X)))
+			w0, w1, w2 := e0.at(start, py), e1.at(start, py), e2.at(start, py)
+			for px := start; px < x1; px, w0, w1, w2 = px+1, w0+e0.a, w1+e1.a, w2+e2.a {
+				// scene point shown by pixel
+				sum := w0 + w1 + w2
+				weight := Vec{w0 / sum, w1 / sum, w2 / sum}
+				x := weight.x*points[0].X + weight.y*points[1].X + weight.z*points[2].X
+				y := weight.x*points[0].Y + weight.y*points[1].Y + weight.z*points[2].Y
+				z := weight.x*z_arr[0] + weight.y*z_arr[1] + weight.z*z_arr[2]
+				depth := cam.depth(Vec{x, y, z * 100})
+
+				if !s.isBackgroundSolidColor && s.backgroundImage != nil {
+					color = s.backgroundImage.At(int(x), int(y))
 				}
 				pColor := color
-				if g.showMesh {
+				if s.showMesh {
 					blueColor := draw.RGBAToColor([4]uint8{0, 0, 255, 255})
-					if x == x0 || y == ymin {
+					if px == x0 || py == ymin {
 						pColor = blueColor
 					} else {
 						continue
 					}
 				}
 
-				cColor, z := calcColor(pColor, g, x, y, n_arr, z_arr, points, normalmapVec)
-
-				alpha := g.alpha
-				beta := g.beta
+				if s.showMesh {
+					buffer.Set(int(px), int(py), depth, pColor)
+					continue
+				}
 
-				vhalf := mat32.NewVec4(
-					float32(g.config.UI.RasterWidth)/2,
-					float32(g.config.UI.RasterWidth)/2,
-					0,
-					0,
-				)
+				if s.debugView == debugViewAO {
+					ao := uint8(s.ambientOcclusion(heights, Vec{x, y, z * 100}) * 255)
+					buffer.Set(int(px), int(py), depth, draw.RGBAToColor([4]uint8{ao, ao, ao, 255}))
+					continue
+				}
 
-				v := mat32.NewVec4(float32(x), float32(y), float32(z*5), 1)
-				v = v.Sub(vhalf)
+				var light reflectedLight
+				switch s.shading {
+				case shadingFlat:
+					light = p.light_arr[0]
+				case shadingGouraud:
+					light = reflectedLight{
+						add3(mult(weight.x, p.light_arr[0].diffuse), mult(weight.y, p.light_arr[1].diffuse), mult(weight.z, p.light_arr[2].diffuse)),
+						add3(mult(weight.x, p.light_arr[0].specular), mult(weight.y, p.light_arr[1].specular), mult(weight.z, p.light_arr[2].specular)),
+					}
+				default:
+					n := normalize(add3(mult(weight.x, n_arr[0]), mult(weight.y, n_arr[1]), mult(weight.z, n_arr[2])))
+					light = calcLight(s, cam, heights, x, y, z, n, s.normalMapVec(x, y))
+				}
+				c := calcColor(pColor, light, s.brdfs[s.brdf].SpecularTint())
+				buffer.SetRadiance(int(px), int(py), depth, s.toneMap(c), c.x, c.y, c.z)
+			}
+		}
+	}
+}
 
-				malpha := mat32.NewMat4()
-				malpha.SetRotationZ(float32(alpha))
-				v = v.MulMat4(malpha)
+// Linear function a*x + b*y + c of image point (x, y)
+type edgeFunction struct {
+	a, b, c float64
+}
 
-				mbeta := mat32.NewMat4()
-				mbeta.SetRotationX(float32(beta))
-				v = v.MulMat4(mbeta)
+func (e edgeFunction) at(x, y float64) float64 {
+	return e.a*x + e.b*y + e.c
+}
 
-				v = v.Add(vhalf)
+// Edge functions of triangle projected to pixels, function of every vertex
+// is the one of opposite edge divided by area and by w coordinate of vertex.
+// Barycentric weights of scene point seen at image point are values of
+// functions there divided by their sum, which corrects them for perspective.
+// ok is false for degenerate triangle.
+func perspectiveEdges(pixels []*geom.Point, w_arr []float64) ([]edgeFunction, bool) {
+	p0, p1, p2 := pixels[0], pixels[1], pixels[2]
+	area := (p1.X-p0.X)*(p2.Y-p0.Y) - (p2.X-p0.X)*(p1.Y-p0.Y)
+	if area == 0 {
+		return nil, false
+	}
+	edges := make([]edgeFunction, 3)
+	for i := range edges {
+		// (pj.X-x)*(pk.Y-y) - (pk.X-x)*(pj.Y-y) expanded
+		pj, pk := pixels[(i+1)%3], pixels[(i+2)%3]
+		scale := 1 / (area * w_arr[i])
+		edges[i] = edgeFunction{
+			a: (pj.Y - pk.Y) * scale,
+			b: (pk.X - pj.X) * scale,
+			c: (pj.X*pk.Y - pk.X*pj.Y) * scale,
+		}
+	}
+	return edges, true
+}
 
-				if g.showMesh {
-					img.Set(int(v.X), int(v.Y), pColor)
-				} else {
-					img.Set(int(v.X), int(v.Y), cColor)
-				}
+// Light reflected towards viewer by surface point for every color channel,
+// before multiplying by object color
+type reflectedLight struct {
+	diffuse  Vec
+	specular Vec
+}
 
-			}
-		}
+// Linear light coming from object with sRGB color c lit by light, tint is
+// how much specular light takes color of object. It isn't clamped, bright
+// light is compressed only by tone mapping.
+func calcColor(c color.Color, light reflectedLight, tint float64) Vec {
+	IOr, IOg, IOb := draw.ColorLinearRGB(c)
+	ISr, ISg, ISb := 1-tint+tint*IOr, 1-tint+tint*IOg, 1-tint+tint*IOb
+
+	return Vec{
+		IOr*light.diffuse.x + ISr*light.specular.x,
+		IOg*light.diffuse.y + ISg*light.specular.y,
+		IOb*light.diffuse.z + ISb*light.specular.z,
 	}
 }
 
-func calcColor(c color.Color, g *Game, x, y float64, n_arr []Vec, z_arr []float64, points []*geom.Point, normalmapVec *Vec) (color.Color, float64) {
-	kd := g.menu.kdSlider.Value
-	ks := g.menu.ksSlider.Value
-	ILr, ILg, ILb, _ := draw.ColorNormalRGBA(g.lightColor)
-	IOr, IOg, IOb, _ := draw.ColorNormalRGBA(c)
-	m := g.menu.mSlider.Value
-
-	p := geom.NewPoint(x, y)
-	v0 := vecFromPoints(*points[0], *points[1])
-	v1 := vecFromPoints(*points[0], *points[2])
-	v2 := vecFromPoints(*points[0], *p)
-	d00 := dotProduct(v0, v0)
-	d01 := dotProduct(v0, v1)
-	d11 := dotProduct(v1, v1)
-	d20 := dotProduct(v2, v0)
-	d21 := dotProduct(v2, v1)
-	denom := d00*d11 - d01*d01
-	wv := (d11*d20 - d01*d21) / denom
-	ww := (d00*d21 - d01*d20) / denom
-	wu := 1 - wv - ww
-	weight := Vec{wu, wv, ww}
-
-	n := add3(mult(weight.x, n_arr[0]), mult(weight.y, n_arr[1]), mult(weight.z, n_arr[2]))
-	n = normalize(n)
-
-	z := z_arr[0]*weight.x + z_arr[1]*weight.y + z_arr[2]*weight.z
+// Light reflected towards viewer by surface point at (x, y) with height z
+// and normal n, according to reflectance model of scene. Ambient light,
+// contributions of lights and of environment are added up in linear light,
+// without clamping. Lights are blocked by surface in heights, if it isn't
+// nil.
+func calcLight(s *Scene, cam *camera, heights *heightField, x, y, z float64, n Vec, normalmapVec *Vec) reflectedLight {
 
 	maxNormalZ := 0.0
 	if normalmapVec != nil {
@@ -212,43 +272,46 @@ func calcColor(c color.Color, g *Game, x, y float64, n_arr []Vec, z_arr []float6
 	}
 	z -= maxNormalZ
 	z *= 100
-	l := Vec{(g.LightPoint.X - x), (g.LightPoint.Y - y), g.lightHeight - z}
-	l = normalize(l)
-
-	v := Vec{0, 0, 1}
-
-	r := minus(mult(2*dotProduct(n, l), n), l)
-	r = normalize(r)
-
-	cosNL := dotProduct(n, l)
-	if cosNL < 0 {
-		cosNL = 0
-	}
-	cosVR := dotProduct(v, r)
-	if cosVR < 0 {
-		cosVR = 0
+	p := Vec{x, y, z}
+	v := cam.viewDirection(p)
+
+	// ambient occlusion darkens ambient and diffuse light, but not highlights
+	ao := s.ambientOcclusion(heights, p)
+	ar, ag, ab := draw.ColorLinearRGB(s.ambientColor)
+	light := reflectedLight{diffuse: mult(s.ka*ao, Vec{ar, ag, ab})}
+	for _, source := range s.lights {
+		l, IL, ok := s.incidentLight(source, p)
+		if !ok {
+			continue
+		}
+		visibility := s.lightVisibility(heights, source, p)
+		if visibility == 0 {
+			continue
+		}
+		IL = mult(visibility, IL)
+		diffuse, specular := s.brdfs[s.brdf].Reflect(n, l, v)
+		light.diffuse = add(light.diffuse, mult(diffuse*ao, IL))
+		light.specular = add(light.specular, mult(specular, IL))
 	}
-	cosmVR := math.Pow(cosVR, m)
-
-	kdcosNL := kd * cosNL * 255
-	kscosmVR := ks * cosmVR * 255
-
-	Ir := math.Min(ILr*IOr*kdcosNL+ILr*IOr*kscosmVR, 255)
-	Ig := math.Min(ILg*IOg*kdcosNL+ILg*IOg*kscosmVR, 255)
-	Ib := math.Min(ILb*IOb*kdcosNL+ILb*IOb*kscosmVR, 255)
 
-	return color.RGBA{uint8(Ir), uint8(Ig), uint8(Ib), 255}, z
-}
-
-func getX(y float64, s geom.Segment) float64 {
-	return s.P0.X + (y-s.P0.Y)*growthRate(s)
+	if environmentBRDF, ok := s.brdfs[s.brdf].(EnvironmentBRDF); ok && s.environment != nil {
+		diffuse, specular, roughness := environmentBRDF.ReflectEnvironment(n, v)
+		rotation := s.environmentRotation * math.Pi / 180
+		r := minus(mult(2*dotProduct(n, v), n), v)
+		E := s.environment.irradianceAt(n, rotation)
+		R := s.environment.reflectionAt(r, roughness, rotation)
+		light.diffuse = add(light.diffuse, mult(diffuse*ao*s.environmentIntensity, E))
+		light.specular = add(light.specular, mult(specular*s.environmentIntensity, R))
+	}
+	return light
 }
 
-func growthRate(s geom.Segment) float64 {
-	if s.P1.Y-s.P0.Y == 0 {
-		return 0
+// Normal map vector at raster point (x, y), nil if there is no normal map
+func (s *Scene) normalMapVec(x, y float64) *Vec {
+	if s.normalMap == nil {
+		return nil
 	}
-	return (s.P1.X - s.P0.X) / (s.P1.Y - s.P0.Y)
+	return getNormalVecFromColor(s.normalMap.At(int(x), int(y)))
 }
 
 func getNormalVecFromColor(c color.Color) *Vec {
@@ -1,101 +1,53 @@
 package main
 
 import (
-	"image"
-	"image/color"
+	"math"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
 	"github.com/zeraye/bezier-shading/pkg/config"
-	"github.com/zeraye/bezier-shading/pkg/draw"
 	"github.com/zeraye/bezier-shading/pkg/geom"
 )
 
 type Game struct {
-	Busy           bool
-	LightPoint     *geom.Point
-	LightAnimation bool
+	Busy bool
 
+	*Scene
 	widget.BaseWidget
 
-	config *config.Config
 	window fyne.Window
 	menu   *Menu
 
-	lightColor             color.Color
-	lightHeight            float64
-	backgroundSolidColor   color.Color
-	backgroundImage        image.Image
-	normalMap              image.Image
-	isBackgroundSolidColor bool
-	points                 [][]*geom.Point
-	pointsHeight           [][]float64
-	triangulation          int
-	triangles              []*geom.Triangle
-	pointHeight            *geom.Point
-	showMesh               bool
-	surface                string
-	alpha                  float64
-	beta                   float64
+	pointHeight       *geom.Point
+	dragMode          int
+	draggedPoint      *geom.Point
+	draggedPointRow   int
+	draggedPointIndex int
+	dragStartPoints   [][]geom.Point
+	viewDragged       bool
+	dragStartView     viewState
+	history           *History
+	lightIndex        int
+	draggedLight      *Light
 }
 
-func NewGame(config *config.Config, window fyne.Window) *Game {
-	menu := NewMenu(config)
-	lightColor := draw.RGBAToColor(config.Defaults.LightColorRGBA)
-	lightAnimation := config.Defaults.LightAnimation
-	lightHeight := config.Defaults.LightHeight
-	lightPoint := geom.NewPoint(float64(config.UI.RasterWidth)/2, float64(config.UI.RasterHeight)/2)
-	triangulation := config.Defaults.Triangulation
-	backgroundSolidColor := draw.RGBAToColor(config.Defaults.DefaultBackgroundSolidColorRGBA)
-
-	size := config.Defaults.InterpolationPointsPerSide
-	points := make([][]*geom.Point, size)
-	for i := 0; i < size; i++ {
-		points[i] = make([]*geom.Point, size)
-	}
-	for i := 0; i < size; i++ {
-		for j := 0; j < size; j++ {
-			points[i][j] = geom.NewPoint(float64(config.UI.RasterWidth*i)/float64(size-1), float64(config.UI.RasterHeight*j)/float64(size-1))
-		}
-	}
-	triangles := makeTriangles(config, points, triangulation)
-
-	pointsHeight := make([][]float64, size)
-	for i := 0; i < size; i++ {
-		pointsHeight[i] = make([]float64, size)
-	}
-	for i := 0; i < size; i++ {
-		for j := 0; j < size; j++ {
-			pointsHeight[i][j] = 0
-		}
-	}
-
-	var backgroundImage image.Image = nil
-	var normalMap image.Image = nil
+const (
+	dragModeLight = iota
+	dragModePoints
+	dragModeOrbit
+	dragModePan
+)
 
+func NewGame(config *config.Config, window fyne.Window) *Game {
 	game := &Game{
-		config:                 config,
-		menu:                   menu,
-		window:                 window,
-		lightColor:             lightColor,
-		LightAnimation:         lightAnimation,
-		lightHeight:            lightHeight,
-		LightPoint:             lightPoint,
-		backgroundSolidColor:   backgroundSolidColor,
-		backgroundImage:        backgroundImage,
-		normalMap:              normalMap,
-		isBackgroundSolidColor: true,
-		points:                 points,
-		pointsHeight:           pointsHeight,
-		triangulation:          triangulation,
-		triangles:              triangles,
-		Busy:                   true,
-		showMesh:               false,
-		surface:                "bezier",
-		alpha:                  0,
-		beta:                   0,
+		Scene:   NewScene(config),
+		menu:    NewMenu(config),
+		window:  window,
+		Busy:    true,
+		history: NewHistory(),
 	}
 
 	game.ExtendBaseWidget(game)
@@ -104,6 +56,17 @@ func NewGame(config *config.Config, window fyne.Window) *Game {
 }
 
 func (g *Game) BuildUI() fyne.CanvasObject {
+	undoShortcut := &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault}
+	redoShortcut := &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierShortcutDefault | fyne.KeyModifierShift}
+	g.window.Canvas().AddShortcut(undoShortcut, func(fyne.Shortcut) {
+		g.history.Undo()
+		g.Refresh()
+	})
+	g.window.Canvas().AddShortcut(redoShortcut, func(fyne.Shortcut) {
+		g.history.Redo()
+		g.Refresh()
+	})
+
 	return container.NewBorder(nil, nil, g.menu.BuildUI(g), g)
 }
 
@@ -116,54 +79,153 @@ func (g *Game) CreateRenderer() fyne.WidgetRenderer {
 	return renderer
 }
 
-func (g *Game) Tapped(ev *fyne.PointEvent) {
-	mouse_pos := geom.NewPoint(float64(ev.Position.X), float64(ev.Position.Y))
+// Position of control point (i, j) on raster seen by camera, points are
+// drawn at their heights, so that they form control net of Bezier surface
+func (g *Game) pointPosition(cam *camera, i, j int) (*geom.Point, bool) {
+	point := g.points[i][j]
+	pixel, _, ok := cam.project(Vec{point.X, point.Y, g.pointsHeight[i][j]})
+	return geom.NewPoint(pixel.x, pixel.y), ok
+}
 
+// Control point drawn at mouse position, nil if none
+func (g *Game) pointAt(mouse_pos *geom.Point) (*geom.Point, int, int) {
+	cam := g.camera(g.config.UI.RasterWidth, g.config.UI.RasterHeight)
 	for points_row_index := range g.points {
 		for point_index, point := range g.points[points_row_index] {
-			if geom.Dist(point, mouse_pos) <= 8 {
-				g.pointHeight = nil
-				g.menu.pointsHeightSlider.SetValue(g.pointsHeight[points_row_index][point_index])
-				g.pointHeight = point
+			position, ok := g.pointPosition(cam, points_row_index, point_index)
+			if ok && geom.Dist(position, mouse_pos) <= 8 {
+				return point, points_row_index, point_index
 			}
 		}
 	}
+	return nil, 0, 0
 }
 
-func (g *Game) TappedSecondary(ev *fyne.PointEvent) {
+// Light selected in menu, it is moved by animation and by dragging when no
+// light is under mouse
+func (g *Game) selectedLight() *Light {
+	return g.lights[max(0, min(g.lightIndex, len(g.lights)-1))]
 }
 
-func (g *Game) Dragged(ev *fyne.DragEvent) {
+// Index of light drawn at mouse position, -1 if none
+func (g *Game) lightAt(mouse_pos *geom.Point) int {
+	cam := g.camera(g.config.UI.RasterWidth, g.config.UI.RasterHeight)
+	for i, light := range g.lights {
+		pixel, _, ok := cam.project(light.position())
+		if ok && geom.Dist(geom.NewPoint(pixel.x, pixel.y), mouse_pos) <= 8 {
+			return i
+		}
+	}
+	return -1
+}
+
+func (g *Game) Tapped(ev *fyne.PointEvent) {
 	mouse_pos := geom.NewPoint(float64(ev.Position.X), float64(ev.Position.Y))
-	g.LightPoint = mouse_pos
+
+	if g.dragMode == dragModeLight {
+		index := g.lightAt(mouse_pos)
+		if index >= 0 {
+			g.menu.lightList.Select(index)
+		}
+		return
+	}
+
+	point, points_row_index, point_index := g.pointAt(mouse_pos)
+	if point != nil {
+		// sliders are set without calling OnChanged, so that the
+		// point isn't edited (and recorded in history)
+		g.pointHeight = point
+		g.menu.pointsHeightSlider.Value = g.pointsHeight[points_row_index][point_index]
+		g.menu.pointsHeightSlider.Refresh()
+		g.menu.pointsWeightSlider.Value = g.pointsWeight[points_row_index][point_index]
+		g.menu.pointsWeightSlider.Refresh()
+	}
 }
 
-func (g *Game) DragEnd() {
+func (g *Game) TappedSecondary(ev *fyne.PointEvent) {
 }
 
-func makeTriangles(config *config.Config, points [][]*geom.Point, triangulation int) []*geom.Triangle {
-	size := config.Defaults.InterpolationPointsPerSide
-	triangles := []*geom.Triangle{}
-	for i := 0; i < size-1; i++ {
-		for j := 0; j < size-1; j++ {
-			for m := 0; m < triangulation; m++ {
-				for n := 0; n < triangulation; n++ {
-					sideLength := float64(config.UI.RasterWidth) / float64((size-1)*triangulation)
-					triangles = append(triangles,
-						geom.NewTriangle(
-							geom.NewPoint(points[i][j].X+float64(m)*sideLength, points[i][j].Y+float64(n)*sideLength),
-							geom.NewPoint(points[i][j].X+float64(m+1)*sideLength, points[i][j].Y+float64(n)*sideLength),
-							geom.NewPoint(points[i][j].X+float64(m)*sideLength, points[i][j].Y+float64(n+1)*sideLength),
-						),
-						geom.NewTriangle(
-							geom.NewPoint(points[i][j].X+float64(m+1)*sideLength, points[i][j].Y+float64(n)*sideLength),
-							geom.NewPoint(points[i][j].X+float64(m+1)*sideLength, points[i][j].Y+float64(n+1)*sideLength),
-							geom.NewPoint(points[i][j].X+float64(m)*sideLength, points[i][j].Y+float64(n+1)*sideLength),
-						),
-					)
-				}
+func (g *Game) Dragged(ev *fyne.DragEvent) {
+	mouse_pos := geom.NewPoint(float64(ev.Position.X), float64(ev.Position.Y))
+	cam := g.camera(g.config.UI.RasterWidth, g.config.UI.RasterHeight)
+	switch g.dragMode {
+	case dragModeLight:
+		if g.draggedLight == nil {
+			start_pos := geom.NewPoint(float64(ev.Position.X-ev.Dragged.DX), float64(ev.Position.Y-ev.Dragged.DY))
+			index := g.lightAt(start_pos)
+			if index >= 0 {
+				g.menu.lightList.Select(index)
 			}
+			g.draggedLight = g.selectedLight()
+		}
+		// light is moved in plane of its height, so that it follows mouse
+		x, y, ok := cam.unproject(mouse_pos.X, mouse_pos.Y, g.draggedLight.height)
+		if ok {
+			g.draggedLight.x, g.draggedLight.y = x, y
+			g.Refresh()
 		}
+		return
+	case dragModeOrbit, dragModePan:
+		if !g.viewDragged {
+			g.viewDragged = true
+			g.dragStartView = g.view()
+		}
+		view := g.view()
+		if g.dragMode == dragModeOrbit {
+			view.alpha = math.Mod(view.alpha+float64(ev.Dragged.DX)*0.01+2*math.Pi, 2*math.Pi)
+			view.beta = math.Max(0, math.Min(view.beta+float64(ev.Dragged.DY)*0.01, math.Pi/2))
+		} else {
+			// scene moves together with mouse, one pixel is 1 / zoom
+			// raster units at camera target
+			delta := minus(mult(float64(ev.Dragged.DX), cam.right), mult(float64(ev.Dragged.DY), cam.up))
+			view.pan = minus(view.pan, mult(1/g.zoom, delta))
+		}
+		setView(g, view)
+		return
 	}
-	return triangles
+
+	if g.draggedPoint == nil {
+		// drag starts where mouse was before first move
+		start_pos := geom.NewPoint(float64(ev.Position.X-ev.Dragged.DX), float64(ev.Position.Y-ev.Dragged.DY))
+		g.draggedPoint, g.draggedPointRow, g.draggedPointIndex = g.pointAt(start_pos)
+		if g.draggedPoint == nil {
+			return
+		}
+		g.dragStartPoints = copyPoints(g.points)
+	}
+
+	// point is moved in plane of its height, so that it follows mouse
+	x, y, ok := cam.unproject(mouse_pos.X, mouse_pos.Y, g.pointsHeight[g.draggedPointRow][g.draggedPointIndex])
+	if !ok {
+		return
+	}
+	x = math.Max(0, math.Min(x, float64(g.config.UI.RasterWidth)))
+	y = math.Max(0, math.Min(y, float64(g.config.UI.RasterHeight)))
+	setPointPosition(g.points, g.draggedPointRow, g.draggedPointIndex, x, y, g.patchDegree, g.editContinuity())
+	g.triangles = makeTriangles(g.points, g.patchDegree, g.triangulation)
+	g.Refresh()
+}
+
+func (g *Game) DragEnd() {
+	if g.draggedPoint != nil {
+		recordEdit(g.history, "points", g.dragStartPoints, copyPoints(g.points), func(points [][]geom.Point) {
+			restorePoints(g.points, points)
+			g.triangles = makeTriangles(g.points, g.patchDegree, g.triangulation)
+			g.Refresh()
+		})
+	}
+	if g.viewDragged {
+		recordEdit(g.history, "view", g.dragStartView, g.view(), func(view viewState) {
+			setView(g, view)
+		})
+	}
+	g.draggedPoint = nil
+	g.draggedLight = nil
+	g.viewDragged = false
+}
+
+// Zoom camera with mouse wheel
+func (g *Game) Scrolled(ev *fyne.ScrollEvent) {
+	zoom := g.zoom * math.Exp(float64(ev.Scrolled.DY)*0.01)
+	g.menu.zoomSlider.SetValue(math.Max(zoomMin, math.Min(zoom, zoomMax)))
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"image"
-	"sync"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -37,25 +36,10 @@ func (gr *gameRenderer) Refresh() {
 
 // Draw game raster (canvas, not menu)
 func (gr *gameRenderer) Draw(width, height int) image.Image {
-	img := image.NewRGBA(image.Rect(0, 0, int(gr.game.config.UI.RasterWidth), int(gr.game.config.UI.RasterHeight)))
-
-	// draw raster background
-	for y := 0; y < img.Bounds().Dy(); y++ {
-		for x := 0; x < img.Bounds().Dx(); x++ {
-			img.Set(x, y, draw.RGBAToColor(gr.game.config.UI.BackgroundColorRGBA))
-		}
-	}
+	img := gr.game.Render(gr.game.config.UI.RasterWidth, gr.game.config.UI.RasterHeight)
 
 	blueColor := draw.RGBAToColor([4]uint8{0, 0, 255, 255})
 	whiteColor := draw.RGBAToColor([4]uint8{255, 255, 255, 255})
-	// yellowColor := draw.RGBAToColor([4]uint8{255, 255, 0, 255})
-
-	var wg sync.WaitGroup
-	wg.Add(len(gr.game.triangles))
-	for _, tri := range gr.game.triangles {
-		go FillPolygon([]*geom.Point{tri.P0, tri.P1, tri.P2}, gr.game.backgroundSolidColor, img, gr.game, &wg)
-	}
-	wg.Wait()
 
 	// if gr.game.showMesh {
 	// 	wg.Add(len(gr.game.triangles))
@@ -65,17 +49,22 @@ func (gr *gameRenderer) Draw(width, height int) image.Image {
 	// 	wg.Wait()
 	// }
 
+	cam := gr.game.camera(img.Bounds().Dx(), img.Bounds().Dy())
 	for points_row_index := range gr.game.points {
-		for _, point := range gr.game.points[points_row_index] {
+		for point_index, point := range gr.game.points[points_row_index] {
+			position, ok := gr.game.pointPosition(cam, points_row_index, point_index)
+			if !ok {
+				continue
+			}
 			if point == gr.game.pointHeight {
-				draw.DrawCircle(*point, 8, blueColor, true, img)
+				draw.DrawCircle(*position, 8, blueColor, true, img)
 			} else {
-				draw.DrawCircle(*point, 8, whiteColor, true, img)
+				draw.DrawCircle(*position, 8, whiteColor, true, img)
 			}
 		}
 	}
 
-	// draw.DrawCircle(*gr.game.LightPoint, 8, yellowColor, true, img)
+	gr.drawLights(cam, img)
 
 	// draw raster border
 	for x := 0; x < img.Bounds().Dx(); x++ {
@@ -91,3 +80,24 @@ func (gr *gameRenderer) Draw(width, height int) image.Image {
 
 	return img
 }
+
+// Draw lights filled with their colors, selected one with outline, and lines
+// showing direction of directional and spot lights
+func (gr *gameRenderer) drawLights(cam *camera, img *image.RGBA) {
+	whiteColor := draw.RGBAToColor([4]uint8{255, 255, 255, 255})
+	target, _, targetOk := cam.project(gr.game.lightTarget())
+	for _, light := range gr.game.lights {
+		pixel, _, ok := cam.project(light.position())
+		if !ok {
+			continue
+		}
+		position := geom.NewPoint(pixel.x, pixel.y)
+		if light.kind != lightTypePoint && targetOk {
+			draw.DrawLine(*position, *geom.NewPoint(target.x, target.y), light.color, img)
+		}
+		draw.DrawCircle(*position, 8, light.color, true, img)
+		if light == gr.game.selectedLight() {
+			draw.DrawCircle(*position, 10, whiteColor, false, img)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+
+	"github.com/zeraye/bezier-shading/pkg/geom"
+)
+
+// Distance between heightfield samples in pixels
+const heightFieldCell = 4
+
+// Number of heightfield rows sampled by one worker
+const heightFieldBand = 16
+
+// Heights of surface (multiplied by 100, like in shading) sampled on regular
+// grid over raster, used to find parts of surface hidden from lights and
+// ambient light
+type heightField struct {
+	columns int
+	rows    int
+	heights []float64 // -Inf where there is no surface
+	max     float64
+}
+
+// Sample surface triangles of scene on heightfield grid, heights are
+// interpolated between heights of surface at triangle vertices (evaluated
+// before rendering), the same as when surface is drawn. The highest triangle
+// is kept where they overlap. Bands of rows are sampled on GOMAXPROCS
+// workers.
+func (s *Scene) heightField(surface [][3]SurfacePoint) *heightField {
+	f := &heightField{
+		columns: s.config.UI.RasterWidth/heightFieldCell + 1,
+		rows:    s.config.UI.RasterHeight/heightFieldCell + 1,
+		max:     math.Inf(-1),
+	}
+	f.heights = make([]float64, f.columns*f.rows)
+	for i := range f.heights {
+		f.heights[i] = math.Inf(-1)
+	}
+
+	bands := (f.rows + heightFieldBand - 1) / heightFieldBand
+	maxima := make([]float64, bands)
+	parallel(bands, func(band int) {
+		firstRow := band * heightFieldBand
+		lastRow := min(firstRow+heightFieldBand, f.rows) - 1
+		maxima[band] = math.Inf(-1)
+		for t, tri := range s.triangles {
+			points := [3]*geom.Point{tri.P0, tri.P1, tri.P2}
+			ymin := math.Min(points[0].Y, math.Min(points[1].Y, points[2].Y))
+			ymax := math.Max(points[0].Y, math.Max(points[1].Y, points[2].Y))
+			if ymax < float64(firstRow*heightFieldCell) || ymin > float64(lastRow*heightFieldCell) {
+				continue
+			}
+			area := (points[1].X-points[0].X)*(points[2].Y-points[0].Y) - (points[2].X-points[0].X)*(points[1].Y-points[0].Y)
+			if area == 0 {
+				continue
+			}
+			var z [3]float64
+			for i := range z {
+				z[i] = surface[t][i].Z * 100
+			}
+
+			xmin := math.Min(points[0].X, math.Min(points[1].X, points[2].X))
+			xmax := math.Max(points[0].X, math.Max(points[1].X, points[2].X))
+			for row := max(firstRow, int(math.Ceil(ymin/heightFieldCell))); row <= lastRow && float64(row*heightFieldCell) <= ymax; row++ {
+				for column := max(0, int(math.Ceil(xmin/heightFieldCell))); column < f.columns && float64(column*heightFieldCell) <= xmax; column++ {
+					x, y := float64(column*heightFieldCell), float64(row*heightFieldCell)
+					w0 := ((points[1].X-x)*(points[2].Y-y) - (points[2].X-x)*(points[1].Y-y)) / area
+					w1 := ((points[2].X-x)*(points[0].Y-y) - (points[0].X-x)*(points[2].Y-y)) / area
+					w2 := 1 - w0 - w1
+					// small tolerance, so that grid points on shared edges
+					// aren't lost
+					if w0 < -1e-9 || w1 < -1e-9 || w2 < -1e-9 {
+						continue
+					}
+					height := w0*z[0] + w1*z[1] + w2*z[2]
+					i := row*f.columns + column
+					f.heights[i] = math.Max(f.heights[i], height)
+					maxima[band] = math.Max(maxima[band], height)
+				}
+			}
+		}
+	})
+	for _, m := range maxima {
+		f.max = math.Max(f.max, m)
+	}
+	return f
+}
+
+// Height of surface at raster point (x, y) from the nearest sample, ok is
+// false outside of grid
+func (f *heightField) at(x, y float64) (float64, bool) {
+	column := int(math.Round(x / heightFieldCell))
+	row := int(math.Round(y / heightFieldCell))
+	if column < 0 || row < 0 || column >= f.columns || row >= f.rows {
+		return 0, false
+	}
+	return f.heights[row*f.columns+column], true
+}
+
+// Normal of heightfield at raster point (x, y) from differences of
+// neighbouring samples, ok is false at edges of surface
+func (f *heightField) normal(x, y float64) (Vec, bool) {
+	left, okLeft := f.at(x-heightFieldCell, y)
+	right, okRight := f.at(x+heightFieldCell, y)
+	top, okTop := f.at(x, y-heightFieldCell)
+	bottom, okBottom := f.at(x, y+heightFieldCell)
+	if !okLeft || !okRight || !okTop || !okBottom || math.IsInf(left+right+top+bottom, -1) {
+		return Vec{}, false
+	}
+	return normalize(Vec{(left - right) / (2 * heightFieldCell), (top - bottom) / (2 * heightFieldCell), 1}), true
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"time"
+
+	"github.com/zeraye/bezier-shading/pkg/geom"
+)
+
+// Edits of the same field made within this time are merged into single
+// history entry (e.g. slider drag)
+const historyMergeTime = time.Second
+
+// Reversible edit of Game field
+type historyEntry struct {
+	field    string
+	oldValue any
+	newValue any
+	apply    func(value any) // set field (and related widgets) to value
+	time     time.Time
+}
+
+// Undo/redo history of scene edits
+type History struct {
+	done     []*historyEntry
+	undone   []*historyEntry
+	applying bool   // true while entry is being undone/redone
+	OnChange func() // called when history changes
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+// Record edit of field from oldValue to newValue. Apply function is called
+// with oldValue on undo and with newValue on redo.
+func recordEdit[T any](h *History, field string, oldValue, newValue T, apply func(value T)) {
+	if h.applying {
+		return
+	}
+
+	now := time.Now()
+	if len(h.done) > 0 && len(h.undone) == 0 {
+		last := h.done[len(h.done)-1]
+		if last.field == field && now.Sub(last.time) < historyMergeTime {
+			last.newValue = newValue
+			last.time = now
+			h.changed()
+			return
+		}
+	}
+
+	h.done = append(h.done, &historyEntry{
+		field:    field,
+		oldValue: oldValue,
+		newValue: newValue,
+		apply:    func(value any) { apply(value.(T)) },
+		time:     now,
+	})
+	h.undone = nil
+	h.changed()
+}
+
+func (h *History) Undo() {
+	if len(h.done) == 0 {
+		return
+	}
+	entry := h.done[len(h.done)-1]
+	h.done = h.done[:len(h.done)-1]
+	h.undone = append(h.undone, entry)
+	h.applyValue(entry, entry.oldValue)
+}
+
+func (h *History) Redo() {
+	if len(h.undone) == 0 {
+		return
+	}
+	entry := h.undone[len(h.undone)-1]
+	h.undone = h.undone[:len(h.undone)-1]
+	h.done = append(h.done, entry)
+	h.applyValue(entry, entry.newValue)
+}
+
+// Undo or redo entries until exactly count entries are done
+func (h *History) GoTo(count int) {
+	for len(h.done) > count && len(h.done) > 0 {
+		h.Undo()
+	}
+	for len(h.done) < count && len(h.undone) > 0 {
+		h.Redo()
+	}
+}
+
+// All entries, done ones followed by undone ones in order they were made
+func (h *History) entries() []*historyEntry {
+	entries := append([]*historyEntry{}, h.done...)
+	for i := len(h.undone) - 1; i >= 0; i-- {
+		entries = append(entries, h.undone[i])
+	}
+	return entries
+}
+
+func (h *History) applyValue(entry *historyEntry, value any) {
+	h.applying = true
+	entry.apply(value)
+	h.applying = false
+	// entry applied later shouldn't be merged with the next edit
+	entry.time = time.Time{}
+	h.changed()
+}
+
+func (h *History) changed() {
+	if h.OnChange != nil {
+		h.OnChange()
+	}
+}
+
+func copyGrid(grid [][]float64) [][]float64 {
+	gridCopy := make([][]float64, len(grid))
+	for i := range grid {
+		gridCopy[i] = append([]float64{}, grid[i]...)
+	}
+	return gridCopy
+}
+
+func copyPoints(points [][]*geom.Point) [][]geom.Point {
+	pointsCopy := make([][]geom.Point, len(points))
+	for i := range points {
+		pointsCopy[i] = make([]geom.Point, len(points[i]))
+		for j, point := range points[i] {
+			pointsCopy[i][j] = *point
+		}
+	}
+	return pointsCopy
+}
+
+// Copy values into existing grids, so that pointers to points stay valid
+func restoreGrid(grid, values [][]float64) {
+	for i := range grid {
+		copy(grid[i], values[i])
+	}
+}
+
+func restorePoints(points [][]*geom.Point, values [][]geom.Point) {
+	for i := range points {
+		for j, point := range points[i] {
+			*point = values[i][j]
+		}
+	}
+}
@@ -1,10 +1,47 @@
 package main
 
 import (
+	"fmt"
 	"image"
+	stddraw "image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zeraye/bezier-shading/pkg/hdr"
+	"golang.org/x/image/tiff"
+)
+
+// Formats images can be exported to
+const (
+	imageFormatPNG    = "PNG"
+	imageFormatPNG16  = "PNG 16-bit"
+	imageFormatJPEG   = "JPEG"
+	imageFormatTIFF   = "TIFF"
+	imageFormatTIFF16 = "TIFF 16-bit"
+	// formats storing linear light of pixels in floating point
+	imageFormatHDR    = "Radiance HDR"
+	imageFormatEXR    = "OpenEXR"
+	imageFormatEXRZIP = "OpenEXR ZIP"
 )
 
+var imageFormats = []string{imageFormatPNG, imageFormatPNG16, imageFormatJPEG, imageFormatTIFF, imageFormatTIFF16, imageFormatHDR, imageFormatEXR, imageFormatEXRZIP}
+
+// File extension of every image format
+var imageFormatExtensions = map[string]string{
+	imageFormatPNG:    ".png",
+	imageFormatPNG16:  ".png",
+	imageFormatJPEG:   ".jpg",
+	imageFormatTIFF:   ".tiff",
+	imageFormatTIFF16: ".tiff",
+	imageFormatHDR:    ".hdr",
+	imageFormatEXR:    ".exr",
+	imageFormatEXRZIP: ".exr",
+}
+
 func getImageFromFilePath(filePath string) (image.Image, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -14,3 +51,112 @@ func getImageFromFilePath(filePath string) (image.Image, error) {
 	image, _, err := image.Decode(f)
 	return image, err
 }
+
+// Image format of file chosen by its extension, deep formats (16 bits per
+// channel) are chosen if deep is true. OpenEXR files are ZIP compressed.
+func imageFormatFromPath(filePath string, deep bool) (string, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".png":
+		if deep {
+			return imageFormatPNG16, nil
+		}
+		return imageFormatPNG, nil
+	case ".jpg", ".jpeg":
+		if deep {
+			return "", fmt.Errorf("JPEG doesn't support 16 bits per channel")
+		}
+		return imageFormatJPEG, nil
+	case ".tif", ".tiff":
+		if deep {
+			return imageFormatTIFF16, nil
+		}
+		return imageFormatTIFF, nil
+	case ".hdr":
+		return imageFormatHDR, nil
+	case ".exr":
+		return imageFormatEXRZIP, nil
+	}
+	return "", fmt.Errorf("unsupported image file extension %q", filepath.Ext(filePath))
+}
+
+// Encode image in given format, quality (1-100) is used only by JPEG
+func encodeImage(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case imageFormatPNG:
+		return png.Encode(w, convertImage(img, false))
+	case imageFormatPNG16:
+		return png.Encode(w, convertImage(img, true))
+	case imageFormatJPEG:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case imageFormatTIFF:
+		return tiff.Encode(w, convertImage(img, false), &tiff.Options{Compression: tiff.Deflate})
+	case imageFormatTIFF16:
+		return tiff.Encode(w, convertImage(img, true), &tiff.Options{Compression: tiff.Deflate})
+	}
+	return fmt.Errorf("unsupported image format %q", format)
+}
+
+// Whether format stores linear light of pixels instead of image
+func isHDRImageFormat(format string) bool {
+	return format == imageFormatHDR || format == imageFormatEXR || format == imageFormatEXRZIP
+}
+
+// Encode linear light of pixels in given floating point format
+func encodeHDRImage(w io.Writer, img *hdr.Image, format string) error {
+	switch format {
+	case imageFormatHDR:
+		return hdr.Encode(w, img)
+	case imageFormatEXR:
+		return hdr.EncodeEXR(w, img, hdr.EXRNone)
+	case imageFormatEXRZIP:
+		return hdr.EncodeEXR(w, img, hdr.EXRZIP)
+	}
+	return fmt.Errorf("unsupported HDR image format %q", format)
+}
+
+// Save linear light of pixels to file in given floating point format
+func saveHDRImageToFilePath(filePath string, img *hdr.Image, format string) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	err = encodeHDRImage(f, img, format)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Save image to file in given format, quality (1-100) is used only by JPEG
+func saveImageToFilePath(filePath string, img image.Image, format string, quality int) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	err = encodeImage(f, img, format, quality)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Convert image to 8 (RGBA) or 16 (RGBA64) bits per channel, encoders choose
+// bit depth by image type
+func convertImage(img image.Image, deep bool) image.Image {
+	var result stddraw.Image
+	if deep {
+		if _, ok := img.(*image.RGBA64); ok {
+			return img
+		}
+		result = image.NewRGBA64(img.Bounds())
+	} else {
+		if _, ok := img.(*image.RGBA); ok {
+			return img
+		}
+		result = image.NewRGBA(img.Bounds())
+	}
+	stddraw.Draw(result, img.Bounds(), img, img.Bounds().Min, stddraw.Src)
+	return result
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+	"github.com/zeraye/bezier-shading/pkg/draw"
+)
+
+// Light types
+const (
+	lightTypePoint = iota
+	lightTypeDirectional
+	lightTypeSpot
+)
+
+// Light source placed above raster point (x, y). Directional and spot lights
+// are aimed at raster centre, directional light shines from direction of its
+// position, the same at every surface point.
+type Light struct {
+	kind      int
+	x         float64
+	y         float64
+	height    float64 // compared with surface height multiplied by 100
+	color     color.Color
+	intensity float64
+	enabled   bool
+	coneAngle float64 // angle between spot light axis and edge of its cone in degrees
+	falloff   float64 // part of cone (0-1) at its edge where spot light fades out
+	// constant, linear and quadratic coefficients of attenuation with
+	// distance, which is measured in units of surface height (100 pixels)
+	attenuation [3]float64
+}
+
+// Enabled point light with unit intensity and without attenuation, spot
+// parameters are set to defaults used when type is changed
+func newLight(x, y, height float64, c color.Color) *Light {
+	return &Light{
+		kind:        lightTypePoint,
+		x:           x,
+		y:           y,
+		height:      height,
+		color:       c,
+		intensity:   1,
+		enabled:     true,
+		coneAngle:   30,
+		falloff:     0.2,
+		attenuation: [3]float64{1, 0, 0},
+	}
+}
+
+// Light above raster centre with color, height and attenuation from config
+func newDefaultLight(config *config.Config) *Light {
+	light := newLight(float64(config.UI.RasterWidth)/2, float64(config.UI.RasterHeight)/2, config.Defaults.LightHeight, draw.RGBAToColor(config.Defaults.LightColorRGBA))
+	light.attenuation = config.Defaults.LightAttenuation
+	return light
+}
+
+func (l *Light) position() Vec {
+	return Vec{l.x, l.y, l.height}
+}
+
+// Point at which directional and spot lights are aimed
+func (s *Scene) lightTarget() Vec {
+	return Vec{float64(s.config.UI.RasterWidth) / 2, float64(s.config.UI.RasterHeight) / 2, 0}
+}
+
+// Light coming to scene point p from light, as normalized direction towards
+// light and color multiplied by intensity for every channel. ok is false if
+// light doesn't reach p.
+func (s *Scene) incidentLight(light *Light, p Vec) (Vec, Vec, bool) {
+	if !light.enabled {
+		return Vec{}, Vec{}, false
+	}
+
+	var l Vec
+	intensity := light.intensity
+	switch light.kind {
+	case lightTypeDirectional:
+		l = normalize(minus(light.position(), s.lightTarget()))
+	case lightTypeSpot:
+		l = normalize(minus(light.position(), p))
+		axis := normalize(minus(s.lightTarget(), light.position()))
+		cosOuter := math.Cos(light.coneAngle * math.Pi / 180)
+		cosInner := math.Cos(light.coneAngle * (1 - light.falloff) * math.Pi / 180)
+		cosAngle := -dotProduct(l, axis)
+		if cosAngle <= cosOuter {
+			return Vec{}, Vec{}, false
+		}
+		if cosAngle < cosInner {
+			// smoothstep between edges of cone and of its fully lit part
+			t := (cosAngle - cosOuter) / (cosInner - cosOuter)
+			intensity *= t * t * (3 - 2*t)
+		}
+	default:
+		l = normalize(minus(light.position(), p))
+	}
+	if light.kind != lightTypeDirectional {
+		d := magnitude(minus(light.position(), p)) / 100
+		intensity /= light.attenuation[0] + light.attenuation[1]*d + light.attenuation[2]*d*d
+	}
+
+	r, g, b := draw.ColorLinearRGB(light.color)
+	return l, Vec{r * intensity, g * intensity, b * intensity}, true
+}
+
+func copyLights(lights []*Light) []*Light {
+	return append([]*Light{}, lights...)
+}
@@ -17,6 +17,14 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if len(os.Args) > 1 && commands[os.Args[1]] != nil {
+		err = commands[os.Args[1]](config, os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	os.Setenv("FYNE_THEME", config.Window.Theme)
 
 	app := app.NewWithID(config.Window.Name)
@@ -46,8 +54,9 @@ func updateLightPoint(game *Game, midX, midY, R, angle *float64) {
 		if !game.Busy {
 			game.Busy = true
 			if game.LightAnimation {
-				game.LightPoint.X = *midX + *R*math.Sin(*angle)
-				game.LightPoint.Y = *midY + *R*math.Cos(*angle)
+				light := game.selectedLight()
+				light.x = *midX + *R*math.Sin(*angle)
+				light.y = *midY + *R*math.Cos(*angle)
 			}
 			game.Refresh()
 		}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"math"
+	"path/filepath"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -15,17 +17,30 @@ import (
 type Menu struct {
 	config                     *config.Config
 	kdSlider                   *widget.Slider
+	kaSlider                   *widget.Slider
 	ksSlider                   *widget.Slider
 	mSlider                    *widget.Slider
 	lightAnimationButton       *widget.Button
-	surfaceButton              *widget.Button
-	lightHeightSlider          *widget.Slider
+	surfaceSelect              *widget.Select
+	lightList                  *widget.List
+	lightControls              *fyne.Container
 	backgroundSolidColorLabel  *widget.Label
 	backgroundSolidColorButton *widget.Button
 	backgroundImageLabel       *widget.Label
 	backgroundImageButton      *widget.Button
 	pointsHeightSlider         *widget.Slider
 	pointsHeightContainer      *fyne.Container
+	continuityRadioButton      *widget.RadioGroup
+	pointsWeightSlider         *widget.Slider
+	knotsUEntry                *widget.Entry
+	knotsVEntry                *widget.Entry
+	surfaceControls            *fyne.Container
+	brdfSelect                 *widget.Select
+	brdfControls               *fyne.Container
+	exponentControls           fyne.CanvasObject
+	alphaSlider                *widget.Slider
+	betaSlider                 *widget.Slider
+	zoomSlider                 *widget.Slider
 }
 
 func NewMenu(config *config.Config) *Menu {
@@ -56,31 +71,130 @@ func (m *Menu) Layout(objects []fyne.CanvasObject, size fyne.Size) {
 func (m *Menu) BuildUI(g *Game) fyne.CanvasObject {
 	title := widget.NewLabelWithStyle("Settings", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
 
-	kdValue := m.config.Defaults.Kd
-	kdBinding := binding.BindFloat(&kdValue)
+	kdBinding := binding.BindFloat(&g.kd)
 	kdLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(kdBinding, "k_d (%0.2f)"))
 	kdSlider := widget.NewSliderWithData(0, 1, kdBinding)
 	kdSlider.Step = 0.01
+	recordBoundSliderEdits(g, kdSlider, "kd", g.kd)
 	m.kdSlider = kdSlider
 
-	ksValue := m.config.Defaults.Ks
-	ksBinding := binding.BindFloat(&ksValue)
+	kaBinding := binding.BindFloat(&g.ka)
+	kaLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(kaBinding, "k_a (%0.2f)"))
+	kaSlider := widget.NewSliderWithData(0, 1, kaBinding)
+	kaSlider.Step = 0.01
+	recordBoundSliderEdits(g, kaSlider, "ka", g.ka)
+	m.kaSlider = kaSlider
+
+	ar, ag, ab, _ := draw.ColorRGBA(g.ambientColor)
+	ambientColorLabel := widget.NewLabel(fmt.Sprintf("ambient: (%d, %d, %d)", ar, ag, ab))
+	ambientColorButton := widget.NewButton("Pick ambient color", ambientColorButtonTapped(g, ambientColorLabel))
+
+	shadowsCheck := widget.NewCheck("shadows", nil)
+	shadowsCheck.Checked = g.shadows
+	shadowsCheck.OnChanged = shadowsCheckChanged(g, shadowsCheck)
+
+	shadowBiasBinding := binding.BindFloat(&g.shadowBias)
+	shadowBiasLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(shadowBiasBinding, "bias (%0.1f)"))
+	shadowBiasSlider := widget.NewSliderWithData(0, 20, shadowBiasBinding)
+	shadowBiasSlider.Step = 0.1
+	recordBoundSliderEdits(g, shadowBiasSlider, "shadowBias", g.shadowBias)
+
+	shadowLightRadiusBinding := binding.BindFloat(&g.shadowLightRadius)
+	shadowLightRadiusLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(shadowLightRadiusBinding, "light radius (%0.0f)"))
+	shadowLightRadiusSlider := widget.NewSliderWithData(0, 100, shadowLightRadiusBinding)
+	shadowLightRadiusSlider.Step = 1
+	recordBoundSliderEdits(g, shadowLightRadiusSlider, "shadowLightRadius", g.shadowLightRadius)
+
+	shadowSamplesLabel := widget.NewLabel(fmt.Sprintf("samples (%d)", g.shadowSamples))
+	shadowSamplesSlider := widget.NewSlider(2, 64)
+	shadowSamplesSlider.Step = 1
+	shadowSamplesSlider.Value = float64(g.shadowSamples)
+	shadowSamplesSlider.OnChanged = shadowSamplesSliderChanged(g, shadowSamplesSlider, shadowSamplesLabel)
+
+	aoCheck := widget.NewCheck("ambient occlusion", nil)
+	aoCheck.Checked = g.ao
+	aoCheck.OnChanged = aoCheckChanged(g, aoCheck)
+
+	aoStrengthBinding := binding.BindFloat(&g.aoStrength)
+	aoStrengthLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(aoStrengthBinding, "strength (%0.2f)"))
+	aoStrengthSlider := widget.NewSliderWithData(0, 1, aoStrengthBinding)
+	aoStrengthSlider.Step = 0.01
+	recordBoundSliderEdits(g, aoStrengthSlider, "aoStrength", g.aoStrength)
+
+	aoRadiusBinding := binding.BindFloat(&g.aoRadius)
+	aoRadiusLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(aoRadiusBinding, "radius (%0.0f)"))
+	aoRadiusSlider := widget.NewSliderWithData(4, 200, aoRadiusBinding)
+	aoRadiusSlider.Step = 1
+	recordBoundSliderEdits(g, aoRadiusSlider, "aoRadius", g.aoRadius)
+
+	aoSamplesLabel := widget.NewLabel(fmt.Sprintf("samples (%d)", g.aoSamples))
+	aoSamplesSlider := widget.NewSlider(1, 64)
+	aoSamplesSlider.Step = 1
+	aoSamplesSlider.Value = float64(g.aoSamples)
+	aoSamplesSlider.OnChanged = aoSamplesSliderChanged(g, aoSamplesSlider, aoSamplesLabel)
+
+	ksBinding := binding.BindFloat(&g.ks)
 	ksLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(ksBinding, "k_s (%0.2f)"))
 	ksSlider := widget.NewSliderWithData(0, 1, ksBinding)
 	ksSlider.Step = 0.01
+	recordBoundSliderEdits(g, ksSlider, "ks", g.ks)
 	m.ksSlider = ksSlider
 
-	mValue := m.config.Defaults.M
-	mBinding := binding.BindFloat(&mValue)
+	mBinding := binding.BindFloat(&g.m)
 	mLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(mBinding, "m (%0.0f)"))
 	mSlider := widget.NewSliderWithData(1, 100, mBinding)
 	mSlider.Step = 1
+	recordBoundSliderEdits(g, mSlider, "m", g.m)
 	m.mSlider = mSlider
 
-	defaultLightColor := draw.RGBAToColor(m.config.Defaults.LightColorRGBA)
-	lcr, lcg, lcb, _ := draw.ColorRGBA(defaultLightColor)
-	lightColorLabel := widget.NewLabel(fmt.Sprintf("color: (%d, %d, %d)", lcr, lcg, lcb))
-	lightColorButton := widget.NewButton("Pick light color", lightColorButtonTapped(g, lightColorLabel))
+	exponentControls := container.NewGridWithColumns(2,
+		container.NewGridWithColumns(2, ksLabel, ksSlider),
+		container.NewGridWithColumns(2, mLabel, mSlider),
+	)
+	m.exponentControls = exponentControls
+
+	brdfLabels := []string{}
+	for _, entry := range brdfRegistry {
+		brdfLabels = append(brdfLabels, entry.label)
+	}
+	brdfLabel := widget.NewLabel("reflectance")
+	brdfSelect := widget.NewSelect(brdfLabels, brdfSelectChanged(g))
+	for _, entry := range brdfRegistry {
+		if entry.name == g.brdf {
+			brdfSelect.Selected = entry.label
+		}
+	}
+	m.brdfSelect = brdfSelect
+
+	brdfControls := container.NewVBox()
+	m.brdfControls = brdfControls
+	m.updateBRDFControls(g)
+
+	lightList := widget.NewList(
+		func() int {
+			return len(g.lights)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			if id >= len(g.lights) {
+				return
+			}
+			item.(*widget.Label).SetText(describeLight(id, g.lights[id]))
+		},
+	)
+	lightList.OnSelected = lightListSelected(g)
+	m.lightList = lightList
+	lightScroll := container.NewVScroll(lightList)
+	lightScroll.SetMinSize(fyne.NewSize(0, 100))
+	addLightButton := widget.NewButton("Add light", addLightButtonTapped(g))
+	removeLightButton := widget.NewButton("Remove light", removeLightButtonTapped(g))
+
+	lightControls := container.NewVBox()
+	m.lightControls = lightControls
+	lightList.Select(g.lightIndex)
+	m.updateLightControls(g)
 
 	lightAnimationButton := widget.NewButton("", animationButtonTapped(g))
 	if g.LightAnimation {
@@ -90,68 +204,243 @@ func (m *Menu) BuildUI(g *Game) fyne.CanvasObject {
 	}
 	m.lightAnimationButton = lightAnimationButton
 
-	lightHeightBinding := binding.BindFloat(&g.lightHeight)
-	lightHeightLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(lightHeightBinding, "light height (%0.0f)"))
-	lightHeightSlider := widget.NewSliderWithData(1, 400, lightHeightBinding)
-	lightHeightSlider.Step = 1
-	m.lightHeightSlider = lightHeightSlider
+	shadingLabel := widget.NewLabel("shading")
+	shadingRadioButton := widget.NewRadioGroup([]string{"Flat", "Gouraud", "Phong"}, nil)
+	shadingRadioButton.Horizontal = true
+	shadingRadioButton.Required = true
+	switch g.shading {
+	case shadingFlat:
+		shadingRadioButton.SetSelected("Flat")
+	case shadingGouraud:
+		shadingRadioButton.SetSelected("Gouraud")
+	default:
+		shadingRadioButton.SetSelected("Phong")
+	}
+	shadingRadioButton.OnChanged = shadingRadioButtonChanged(g, shadingRadioButton)
+
+	toneMappingLabel := widget.NewLabel("tone mapping")
+	toneMappingRadioButton := widget.NewRadioGroup([]string{"Clamp", "Reinhard", "ACES"}, nil)
+	toneMappingRadioButton.Horizontal = true
+	toneMappingRadioButton.Required = true
+	switch g.toneMapping {
+	case toneMappingClamp:
+		toneMappingRadioButton.SetSelected("Clamp")
+	case toneMappingReinhard:
+		toneMappingRadioButton.SetSelected("Reinhard")
+	default:
+		toneMappingRadioButton.SetSelected("ACES")
+	}
+	toneMappingRadioButton.OnChanged = toneMappingRadioButtonChanged(g, toneMappingRadioButton)
+
+	exposureBinding := binding.BindFloat(&g.exposure)
+	exposureLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(exposureBinding, "exposure (%+0.1f)"))
+	exposureSlider := widget.NewSliderWithData(-5, 5, exposureBinding)
+	exposureSlider.Step = 0.1
+	recordBoundSliderEdits(g, exposureSlider, "exposure", g.exposure)
+
+	gammaBinding := binding.BindFloat(&g.gamma)
+	gammaLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(gammaBinding, "gamma (%0.1f)"))
+	gammaSlider := widget.NewSliderWithData(1, 3, gammaBinding)
+	gammaSlider.Step = 0.1
+	recordBoundSliderEdits(g, gammaSlider, "gamma", g.gamma)
 
 	backgroundRadioButton := widget.NewRadioGroup([]string{"Solid color", "Image"}, nil)
-	backgroundRadioButton.SetSelected("Solid color")
+	if g.isBackgroundSolidColor {
+		backgroundRadioButton.SetSelected("Solid color")
+	} else {
+		backgroundRadioButton.SetSelected("Image")
+	}
 	backgroundRadioButton.OnChanged = backgroundRadioButtonChanged(g, backgroundRadioButton)
 
-	defaultBackgroundSolidColor := draw.RGBAToColor(m.config.Defaults.DefaultBackgroundSolidColorRGBA)
-	bscr, bscg, bscb, _ := draw.ColorRGBA(defaultBackgroundSolidColor)
+	bscr, bscg, bscb, _ := draw.ColorRGBA(g.backgroundSolidColor)
 	backgroundSolidColorLabel := widget.NewLabel(fmt.Sprintf("color: (%d, %d, %d)", bscr, bscg, bscb))
 	backgroundSolidColorButton := widget.NewButton("Pick background solid color", backgroundSolidColorButtonTapped(g, backgroundSolidColorLabel))
 	m.backgroundSolidColorLabel = backgroundSolidColorLabel
 	m.backgroundSolidColorButton = backgroundSolidColorButton
 
-	backgroundImageLabel := widget.NewLabel("file: -")
+	backgroundImageLabel := widget.NewLabel(fileLabelText(g.backgroundImagePath))
 	backgroundImageButton := widget.NewButton("Open background image file", backgroundImageButtonTapped(g, backgroundImageLabel))
-	backgroundImageLabel.Hide()
-	backgroundImageButton.Hide()
+	if g.isBackgroundSolidColor {
+		backgroundImageLabel.Hide()
+		backgroundImageButton.Hide()
+	} else {
+		backgroundSolidColorLabel.Hide()
+		backgroundSolidColorButton.Hide()
+	}
 	m.backgroundImageLabel = backgroundImageLabel
 	m.backgroundImageButton = backgroundImageButton
 
-	normalMapLabel := widget.NewLabel("file: -")
+	normalMapLabel := widget.NewLabel(fileLabelText(g.normalMapPath))
 	normalMapButton := widget.NewButton("Open normal map file", normalMapButtonTapped(g, normalMapLabel))
 
+	environmentLabel := widget.NewLabel(fileLabelText(g.environmentPath))
+	environmentButton := widget.NewButton("Open environment file", environmentButtonTapped(g, environmentLabel))
+	removeEnvironmentButton := widget.NewButton("Remove environment", removeEnvironmentButtonTapped(g, environmentLabel))
+
+	environmentIntensityBinding := binding.BindFloat(&g.environmentIntensity)
+	environmentIntensityLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(environmentIntensityBinding, "intensity (%0.2f)"))
+	environmentIntensitySlider := widget.NewSliderWithData(0, 5, environmentIntensityBinding)
+	environmentIntensitySlider.Step = 0.05
+	recordBoundSliderEdits(g, environmentIntensitySlider, "environmentIntensity", g.environmentIntensity)
+
+	environmentRotationBinding := binding.BindFloat(&g.environmentRotation)
+	environmentRotationLabel := widget.NewLabelWithData(binding.FloatToStringWithFormat(environmentRotationBinding, "rotation (%0.0f°)"))
+	environmentRotationSlider := widget.NewSliderWithData(0, 360, environmentRotationBinding)
+	environmentRotationSlider.Step = 1
+	recordBoundSliderEdits(g, environmentRotationSlider, "environmentRotation", g.environmentRotation)
+
 	triangulationLabel := widget.NewLabel("triangulation")
-	triangulationSlider := widget.NewSlider(2, 29)
+	triangulationSlider := widget.NewSlider(triangulationMin, triangulationMax)
 	triangulationSlider.Step = 1
 	triangulationSlider.OnChanged = triangulationSliderChanged(g, triangulationSlider)
-	triangulationSlider.Value = float64(g.config.Defaults.Triangulation)
+	triangulationSlider.Value = float64(g.triangulation)
 	triangulationCheck := widget.NewCheck("show mesh", triangulationCheckChanged(g))
+	triangulationCheck.Checked = g.showMesh
 
 	pointsHeightLabel := widget.NewLabel("point height")
 	pointsHeightSlider := widget.NewSlider(0, 200)
 	pointsHeightSlider.OnChanged = pointsHeightSliderChanged(g, pointsHeightSlider)
 	m.pointsHeightSlider = pointsHeightSlider
-	pointsHeightContainer := container.NewGridWithColumns(2, pointsHeightLabel, pointsHeightSlider)
+	continuityRadioButton := widget.NewRadioGroup([]string{"C0", "C1"}, nil)
+	continuityRadioButton.Horizontal = true
+	continuityRadioButton.Required = true
+	if g.continuity == continuityC1 {
+		continuityRadioButton.SetSelected("C1")
+	} else {
+		continuityRadioButton.SetSelected("C0")
+	}
+	continuityRadioButton.OnChanged = continuityRadioButtonChanged(g, continuityRadioButton)
+	m.continuityRadioButton = continuityRadioButton
+	pointsHeightContainer := container.NewGridWithColumns(3, pointsHeightLabel, pointsHeightSlider, continuityRadioButton)
 	m.pointsHeightContainer = pointsHeightContainer
 
-	surfaceButton := widget.NewButton("Bezier (currently)", surfaceButtonTapped(g))
-	m.surfaceButton = surfaceButton
+	surfaceLabels := []string{}
+	for _, entry := range surfaceRegistry {
+		surfaceLabels = append(surfaceLabels, entry.label)
+	}
+	surfaceLabel := widget.NewLabel("surface")
+	surfaceSelect := widget.NewSelect(surfaceLabels, surfaceSelectChanged(g))
+	for _, entry := range surfaceRegistry {
+		if entry.name == g.surface {
+			surfaceSelect.Selected = entry.label
+		}
+	}
+	m.surfaceSelect = surfaceSelect
+
+	pointsWeightLabel := widget.NewLabel("point weight")
+	pointsWeightSlider := widget.NewSlider(0.1, 10)
+	pointsWeightSlider.Step = 0.1
+	pointsWeightSlider.Value = 1
+	pointsWeightSlider.OnChanged = pointsWeightSliderChanged(g, pointsWeightSlider)
+	m.pointsWeightSlider = pointsWeightSlider
+
+	knotsULabel := widget.NewLabel("knots u")
+	knotsUEntry := widget.NewEntry()
+	knotsUEntry.SetText(formatKnots(g.knotsU))
+	knotsUEntry.OnSubmitted = knotsEntrySubmitted(g, &g.knotsU, "knotsU", knotsUEntry)
+	m.knotsUEntry = knotsUEntry
+
+	knotsVLabel := widget.NewLabel("knots v")
+	knotsVEntry := widget.NewEntry()
+	knotsVEntry.SetText(formatKnots(g.knotsV))
+	knotsVEntry.OnSubmitted = knotsEntrySubmitted(g, &g.knotsV, "knotsV", knotsVEntry)
+	m.knotsVEntry = knotsVEntry
+
+	dragModeLabel := widget.NewLabel("drag")
+	dragModeRadioButton := widget.NewRadioGroup([]string{"Light", "Control points", "Orbit", "Pan"}, nil)
+	dragModeRadioButton.Horizontal = true
+	dragModeRadioButton.Required = true
+	dragModeRadioButton.SetSelected("Light")
+	dragModeRadioButton.OnChanged = dragModeRadioButtonChanged(g)
 
-	alphaSlider := widget.NewSlider(0, 2)
+	surfaceControls := container.NewVBox()
+	m.surfaceControls = surfaceControls
+	m.updateSurfaceControls(g)
+
+	uniformKnotsButton := widget.NewButton("Uniform knots", knotsButtonTapped(g, uniformKnots))
+	clampedKnotsButton := widget.NewButton("Clamped knots", knotsButtonTapped(g, clampedKnots))
+
+	projectionLabel := widget.NewLabel("camera")
+	projectionRadioButton := widget.NewRadioGroup([]string{"Orthographic", "Perspective"}, nil)
+	projectionRadioButton.Horizontal = true
+	projectionRadioButton.Required = true
+	if g.projection == projectionPerspective {
+		projectionRadioButton.SetSelected("Perspective")
+	} else {
+		projectionRadioButton.SetSelected("Orthographic")
+	}
+	projectionRadioButton.OnChanged = projectionRadioButtonChanged(g, projectionRadioButton)
+
+	fovLabel := widget.NewLabel(fmt.Sprintf("field of view (%0.0f)", g.fov))
+	fovSlider := widget.NewSlider(10, 120)
+	fovSlider.OnChanged = fovSliderChanged(g, fovLabel, fovSlider)
+	fovSlider.Step = 1
+	fovSlider.Value = g.fov
+
+	alphaLabel := widget.NewLabel("rotation")
+	alphaSlider := widget.NewSlider(0, 2*math.Pi)
 	alphaSlider.OnChanged = alphaSliderChanged(g, alphaSlider)
 	alphaSlider.Step = 0.01
-	alphaSlider.Value = 0.0
+	alphaSlider.Value = g.alpha
+	m.alphaSlider = alphaSlider
 
-	betaSlider := widget.NewSlider(0, 2)
+	betaLabel := widget.NewLabel("tilt")
+	betaSlider := widget.NewSlider(0, math.Pi/2)
 	betaSlider.OnChanged = betaSliderChanged(g, betaSlider)
 	betaSlider.Step = 0.01
-	betaSlider.Value = 0.0
+	betaSlider.Value = g.beta
+	m.betaSlider = betaSlider
 
-	return container.New(m, title, container.NewVBox(
+	zoomLabel := widget.NewLabel("zoom")
+	zoomSlider := widget.NewSlider(zoomMin, zoomMax)
+	zoomSlider.OnChanged = zoomSliderChanged(g, zoomSlider)
+	zoomSlider.Step = 0.01
+	zoomSlider.Value = g.zoom
+	m.zoomSlider = zoomSlider
+
+	resetViewButton := widget.NewButton("Reset view", resetViewButtonTapped(g))
+
+	debugViewLabel := widget.NewLabel("show")
+	debugViewSelect := widget.NewSelect([]string{"Shaded", "Depth", "Ambient occlusion"}, debugViewSelectChanged(g))
+	debugViewSelect.Selected = "Shaded"
+
+	lightTab := container.NewVBox(
+		container.NewGridWithColumns(2, brdfLabel, brdfSelect),
+		container.NewGridWithColumns(2, kdLabel, kdSlider),
+		brdfControls,
 		container.NewGridWithColumns(2,
-			container.NewGridWithColumns(2, kdLabel, kdSlider),
-			container.NewGridWithColumns(2, ksLabel, ksSlider),
+			container.NewGridWithColumns(2, kaLabel, kaSlider),
+			container.NewGridWithColumns(2, ambientColorLabel, ambientColorButton),
 		),
-		container.NewGridWithColumns(2, mLabel, mSlider),
-		container.NewGridWithColumns(2, lightColorLabel, lightColorButton),
-		container.NewGridWithColumns(2, lightHeightLabel, lightHeightSlider),
+		container.NewGridWithColumns(2, shadingLabel, shadingRadioButton),
+		container.NewGridWithColumns(2,
+			shadowsCheck,
+			container.NewGridWithColumns(2, shadowBiasLabel, shadowBiasSlider),
+		),
+		container.NewGridWithColumns(2,
+			container.NewGridWithColumns(2, shadowLightRadiusLabel, shadowLightRadiusSlider),
+			container.NewGridWithColumns(2, shadowSamplesLabel, shadowSamplesSlider),
+		),
+		container.NewGridWithColumns(2,
+			aoCheck,
+			container.NewGridWithColumns(2, aoStrengthLabel, aoStrengthSlider),
+		),
+		container.NewGridWithColumns(2,
+			container.NewGridWithColumns(2, aoRadiusLabel, aoRadiusSlider),
+			container.NewGridWithColumns(2, aoSamplesLabel, aoSamplesSlider),
+		),
+		lightScroll,
+		container.NewGridWithColumns(2, addLightButton, removeLightButton),
+		lightControls,
+		lightAnimationButton,
+	)
+
+	saveSceneButton := widget.NewButton("Save scene", saveSceneButtonTapped(g))
+	openSceneButton := widget.NewButton("Open scene", openSceneButtonTapped(g))
+	exportImageButton := widget.NewButton("Export image", exportImageButtonTapped(g))
+	exportMeshButton := widget.NewButton("Export mesh", exportMeshButtonTapped(g))
+
+	sceneTab := container.NewVBox(
 		backgroundRadioButton,
 		backgroundSolidColorLabel,
 		backgroundSolidColorButton,
@@ -159,9 +448,208 @@ func (m *Menu) BuildUI(g *Game) fyne.CanvasObject {
 		backgroundImageButton,
 		normalMapLabel,
 		normalMapButton,
+		container.NewGridWithColumns(2, projectionLabel, projectionRadioButton),
+		container.NewGridWithColumns(2, fovLabel, fovSlider),
+		container.NewGridWithColumns(2,
+			container.NewGridWithColumns(2, alphaLabel, alphaSlider),
+			container.NewGridWithColumns(2, betaLabel, betaSlider),
+		),
+		container.NewGridWithColumns(3, zoomLabel, zoomSlider, resetViewButton),
+		container.NewGridWithColumns(2, debugViewLabel, debugViewSelect),
+		container.NewGridWithColumns(2, toneMappingLabel, toneMappingRadioButton),
+		container.NewGridWithColumns(2,
+			container.NewGridWithColumns(2, exposureLabel, exposureSlider),
+			container.NewGridWithColumns(2, gammaLabel, gammaSlider),
+		),
+		container.NewGridWithColumns(2, saveSceneButton, openSceneButton),
+		container.NewGridWithColumns(2, exportImageButton, exportMeshButton),
+	)
+
+	surfaceTab := container.NewVBox(
+		container.NewGridWithColumns(2, surfaceLabel, surfaceSelect),
 		container.NewGridWithColumns(3, triangulationLabel, triangulationSlider, triangulationCheck),
-		container.NewGridWithColumns(2, lightAnimationButton, surfaceButton),
 		pointsHeightContainer,
-		container.NewGridWithColumns(2, alphaSlider, betaSlider),
+		container.NewGridWithColumns(2, dragModeLabel, dragModeRadioButton),
+		container.NewGridWithColumns(2, pointsWeightLabel, pointsWeightSlider),
+		container.NewGridWithColumns(2, knotsULabel, knotsUEntry),
+		container.NewGridWithColumns(2, knotsVLabel, knotsVEntry),
+		container.NewGridWithColumns(2, uniformKnotsButton, clampedKnotsButton),
+		surfaceControls,
+	)
+
+	environmentTab := container.NewVBox(
+		environmentLabel,
+		container.NewGridWithColumns(2, environmentButton, removeEnvironmentButton),
+		container.NewGridWithColumns(2, environmentIntensityLabel, environmentIntensitySlider),
+		container.NewGridWithColumns(2, environmentRotationLabel, environmentRotationSlider),
+	)
+
+	undoButton := widget.NewButton("Undo", undoButtonTapped(g))
+	redoButton := widget.NewButton("Redo", redoButtonTapped(g))
+	historyList := widget.NewList(
+		func() int {
+			return len(g.history.entries())
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			entries := g.history.entries()
+			if id >= len(entries) {
+				return
+			}
+			text := describeHistoryEntry(entries[id])
+			if id >= len(g.history.done) {
+				text += " (undone)"
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+	historyList.OnSelected = historyListSelected(g, historyList)
+	g.history.OnChange = historyList.Refresh
+	historyScroll := container.NewVScroll(historyList)
+	historyScroll.SetMinSize(fyne.NewSize(0, 400))
+
+	historyTab := container.NewVBox(
+		container.NewGridWithColumns(2, undoButton, redoButton),
+		historyScroll,
+	)
+
+	return container.New(m, title, container.NewAppTabs(
+		container.NewTabItem("Light", lightTab),
+		container.NewTabItem("Surface", surfaceTab),
+		container.NewTabItem("Scene", sceneTab),
+		container.NewTabItem("Environment", environmentTab),
+		container.NewTabItem("History", historyTab),
 	))
 }
+
+// Rebuild controls specific to active surface (file chooser, parameters),
+// continuity is shown only for surfaces keeping it when points are moved
+func (m *Menu) updateSurfaceControls(g *Game) {
+	if g.splineSurface() {
+		m.continuityRadioButton.Hide()
+	} else {
+		m.continuityRadioButton.Show()
+	}
+	objects := []fyne.CanvasObject{}
+	surface := g.surfaces[g.surface]
+	if fileSurface, ok := surface.(FileSurface); ok {
+		surfaceFileLabel := widget.NewLabel(fileLabelText(fileSurface.FilePath()))
+		surfaceFileButton := widget.NewButton("Open surface file", surfaceFileButtonTapped(g, fileSurface, surfaceFileLabel))
+		objects = append(objects, container.NewGridWithColumns(2, surfaceFileLabel, surfaceFileButton))
+	}
+	if configurable, ok := surface.(Configurable); ok {
+		for _, param := range configurable.Params() {
+			objects = append(objects, newParamSlider(g, g.surface, param))
+		}
+	}
+	m.surfaceControls.Objects = objects
+	m.surfaceControls.Refresh()
+}
+
+// Rebuild controls of parameters used by active reflectance model
+func (m *Menu) updateBRDFControls(g *Game) {
+	objects := []fyne.CanvasObject{}
+	brdf := g.brdfs[g.brdf]
+	if _, ok := brdf.(ExponentSpecular); ok {
+		objects = append(objects, m.exponentControls)
+	}
+	if configurable, ok := brdf.(Configurable); ok {
+		for _, param := range configurable.Params() {
+			objects = append(objects, newParamSlider(g, g.brdf, param))
+		}
+	}
+	m.brdfControls.Objects = objects
+	m.brdfControls.Refresh()
+}
+
+// Rebuild controls of light selected in list, spot light parameters are shown
+// only for spot lights and attenuation isn't shown for directional lights
+func (m *Menu) updateLightControls(g *Game) {
+	light := g.selectedLight()
+	field := fmt.Sprintf("light %d", g.lightIndex+1)
+
+	typeRadioButton := widget.NewRadioGroup(lightTypeLabels, nil)
+	typeRadioButton.Horizontal = true
+	typeRadioButton.Required = true
+	typeRadioButton.SetSelected(lightTypeLabels[light.kind])
+	typeRadioButton.OnChanged = lightTypeRadioButtonChanged(g, light, field)
+	enabledCheck := widget.NewCheck("enabled", lightEnabledCheckChanged(g, light, field))
+	enabledCheck.Checked = light.enabled
+
+	red, green, blue, _ := draw.ColorRGBA(light.color)
+	colorLabel := widget.NewLabel(fmt.Sprintf("color: (%d, %d, %d)", red, green, blue))
+	colorButton := widget.NewButton("Pick light color", lightColorButtonTapped(g, light, field))
+
+	params := []Param{
+		{Name: "intensity", Min: 0, Max: 5, Step: 0.01, Value: &light.intensity},
+		{Name: "height", Min: 1, Max: 400, Step: 1, Value: &light.height},
+	}
+	if light.kind != lightTypeDirectional {
+		params = append(params,
+			Param{Name: "constant attenuation", Min: 0.1, Max: 2, Step: 0.01, Value: &light.attenuation[0]},
+			Param{Name: "linear attenuation", Min: 0, Max: 2, Step: 0.01, Value: &light.attenuation[1]},
+			Param{Name: "quadratic attenuation", Min: 0, Max: 2, Step: 0.01, Value: &light.attenuation[2]},
+		)
+	}
+	if light.kind == lightTypeSpot {
+		params = append(params,
+			Param{Name: "cone angle", Min: 1, Max: 89, Step: 1, Value: &light.coneAngle},
+			Param{Name: "falloff", Min: 0, Max: 1, Step: 0.01, Value: &light.falloff},
+		)
+	}
+
+	objects := []fyne.CanvasObject{
+		container.NewGridWithColumns(2, typeRadioButton, enabledCheck),
+		container.NewGridWithColumns(2, colorLabel, colorButton),
+	}
+	for _, param := range params {
+		paramLabel := widget.NewLabel(fmt.Sprintf("%s (%0.2f)", param.Name, *param.Value))
+		paramSlider := widget.NewSlider(param.Min, param.Max)
+		paramSlider.Step = param.Step
+		paramSlider.Value = *param.Value
+		paramSlider.OnChanged = lightSliderChanged(g, light, field, param, paramLabel)
+		objects = append(objects, container.NewGridWithColumns(2, paramLabel, paramSlider))
+	}
+	m.lightControls.Objects = objects
+	m.lightControls.Refresh()
+}
+
+// Text of light list item
+func describeLight(index int, light *Light) string {
+	text := fmt.Sprintf("%d. %s light", index+1, lightTypeLabels[light.kind])
+	if !light.enabled {
+		text += " (off)"
+	}
+	return text
+}
+
+// Slider of parameter of surface or reflectance model with given name
+func newParamSlider(g *Game, name string, param Param) fyne.CanvasObject {
+	paramLabel := widget.NewLabel(fmt.Sprintf("%s (%0.2f)", param.Name, *param.Value))
+	paramSlider := widget.NewSlider(param.Min, param.Max)
+	paramSlider.Step = param.Step
+	paramSlider.Value = *param.Value
+	paramSlider.OnChanged = paramSliderChanged(g, name, param, paramLabel, paramSlider)
+	return container.NewGridWithColumns(2, paramLabel, paramSlider)
+}
+
+// Text of history list item, values of simple types are shown
+func describeHistoryEntry(entry *historyEntry) string {
+	switch oldValue := entry.oldValue.(type) {
+	case float64:
+		return fmt.Sprintf("%s: %0.2f -> %0.2f", entry.field, oldValue, entry.newValue)
+	case string:
+		return fmt.Sprintf("%s: %s -> %s", entry.field, oldValue, entry.newValue)
+	}
+	return entry.field
+}
+
+// Text of label showing name of loaded file
+func fileLabelText(path string) string {
+	if path == "" {
+		return "file: -"
+	}
+	return "file: " + filepath.Base(path)
+}
@@ -2,26 +2,178 @@ package main
 
 import (
 	"fmt"
+	"image"
 	"image/color"
+	"slices"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 	"github.com/zeraye/bezier-shading/pkg/draw"
+	"github.com/zeraye/bezier-shading/pkg/geom"
+	"github.com/zeraye/bezier-shading/pkg/scenefile"
 )
 
-func lightColorPickerCallback(g *Game, lightColorLabel *widget.Label) func(color.Color) {
-	return func(c color.Color) {
-		g.lightColor = c
-		r, g, b, _ := draw.ColorRGBA(g.lightColor)
-		lightColorLabel.Text = fmt.Sprintf("color: (%d, %d, %d)", r, g, b)
-		lightColorLabel.Refresh()
+// Labels of light types, indexed by type
+var lightTypeLabels = []string{"Point", "Directional", "Spot"}
+
+// Apply edit to light and record it in history, whole light is stored, so
+// that one function restores any of its fields. Position isn't restored, it
+// is changed by dragging and animation, which aren't recorded.
+func editLight(g *Game, light *Light, field string, edit func()) {
+	oldLight := *light
+	edit()
+	recordEdit(g.history, field, oldLight, *light, func(value Light) {
+		value.x, value.y = light.x, light.y
+		*light = value
+		g.menu.lightList.Refresh()
+		g.menu.updateLightControls(g)
+		g.Refresh()
+	})
+	g.menu.lightList.Refresh()
+	g.Refresh()
+}
+
+func lightTypeRadioButtonChanged(g *Game, light *Light, field string) func(string) {
+	return func(option string) {
+		kind := slices.Index(lightTypeLabels, option)
+		if kind < 0 {
+			panic("Invalid entry for light type radio button")
+		}
+		editLight(g, light, field+" type", func() {
+			light.kind = kind
+		})
+		g.menu.updateLightControls(g)
+	}
+}
+
+func lightEnabledCheckChanged(g *Game, light *Light, field string) func(bool) {
+	return func(value bool) {
+		editLight(g, light, field+" enabled", func() {
+			light.enabled = value
+		})
+	}
+}
+
+func lightSliderChanged(g *Game, light *Light, field string, param Param, paramLabel *widget.Label) func(float64) {
+	return func(value float64) {
+		editLight(g, light, field+" "+param.Name, func() {
+			*param.Value = value
+		})
+		paramLabel.Text = fmt.Sprintf("%s (%0.2f)", param.Name, value)
+		paramLabel.Refresh()
+	}
+}
+
+func lightColorButtonTapped(g *Game, light *Light, field string) func() {
+	return func() {
+		dialog.ShowColorPicker("Color picker", "light color", func(c color.Color) {
+			editLight(g, light, field+" color", func() {
+				light.color = c
+			})
+			g.menu.updateLightControls(g)
+		}, g.window)
 	}
 }
 
-func lightColorButtonTapped(g *Game, lightColorLabel *widget.Label) func() {
+func lightListSelected(g *Game) func(widget.ListItemID) {
+	return func(id widget.ListItemID) {
+		g.lightIndex = id
+		g.menu.updateLightControls(g)
+	}
+}
+
+// Set list of lights, keeping selection in range, without recording edit
+func setLights(g *Game, lights []*Light) {
+	g.lights = copyLights(lights)
+	g.lightIndex = min(g.lightIndex, len(g.lights)-1)
+	g.menu.lightList.Refresh()
+	g.menu.lightList.Select(g.lightIndex)
+	g.menu.updateLightControls(g)
+	g.Refresh()
+}
+
+func addLightButtonTapped(g *Game) func() {
 	return func() {
-		dialog.ShowColorPicker("Color picker", "light color", lightColorPickerCallback(g, lightColorLabel), g.window)
+		oldLights := copyLights(g.lights)
+		lights := append(copyLights(g.lights), newDefaultLight(g.config))
+		recordEdit(g.history, "lights", oldLights, lights, func(lights []*Light) {
+			setLights(g, lights)
+		})
+		g.lightIndex = len(lights) - 1
+		setLights(g, lights)
+	}
+}
+
+// The last light can't be removed, scene always has at least one
+func removeLightButtonTapped(g *Game) func() {
+	return func() {
+		if len(g.lights) <= 1 {
+			return
+		}
+		oldLights := copyLights(g.lights)
+		lights := slices.Delete(copyLights(g.lights), g.lightIndex, g.lightIndex+1)
+		recordEdit(g.history, "lights", oldLights, lights, func(lights []*Light) {
+			setLights(g, lights)
+		})
+		setLights(g, lights)
+	}
+}
+
+func setAmbientColor(g *Game, ambientColorLabel *widget.Label, c color.Color) {
+	g.ambientColor = c
+	red, green, blue, _ := draw.ColorRGBA(g.ambientColor)
+	ambientColorLabel.Text = fmt.Sprintf("ambient: (%d, %d, %d)", red, green, blue)
+	ambientColorLabel.Refresh()
+	g.Refresh()
+}
+
+func ambientColorButtonTapped(g *Game, ambientColorLabel *widget.Label) func() {
+	return func() {
+		dialog.ShowColorPicker("Color picker", "ambient color", func(c color.Color) {
+			recordEdit(g.history, "ambientColor", g.ambientColor, c, func(c color.Color) {
+				setAmbientColor(g, ambientColorLabel, c)
+			})
+			setAmbientColor(g, ambientColorLabel, c)
+		}, g.window)
+	}
+}
+
+func shadowsCheckChanged(g *Game, shadowsCheck *widget.Check) func(bool) {
+	return func(value bool) {
+		recordEdit(g.history, "shadows", g.shadows, value, shadowsCheck.SetChecked)
+		g.shadows = value
+		g.Refresh()
+	}
+}
+
+func shadowSamplesSliderChanged(g *Game, shadowSamplesSlider *widget.Slider, shadowSamplesLabel *widget.Label) func(float64) {
+	return func(value float64) {
+		recordEdit(g.history, "shadowSamples", float64(g.shadowSamples), value, shadowSamplesSlider.SetValue)
+		shadowSamplesSlider.Value = value
+		g.shadowSamples = int(value)
+		shadowSamplesLabel.SetText(fmt.Sprintf("samples (%d)", g.shadowSamples))
+		shadowSamplesSlider.Refresh()
+		g.Refresh()
+	}
+}
+
+func aoCheckChanged(g *Game, aoCheck *widget.Check) func(bool) {
+	return func(value bool) {
+		recordEdit(g.history, "ao", g.ao, value, aoCheck.SetChecked)
+		g.ao = value
+		g.Refresh()
+	}
+}
+
+func aoSamplesSliderChanged(g *Game, aoSamplesSlider *widget.Slider, aoSamplesLabel *widget.Label) func(float64) {
+	return func(value float64) {
+		recordEdit(g.history, "aoSamples", float64(g.aoSamples), value, aoSamplesSlider.SetValue)
+		aoSamplesSlider.Value = value
+		g.aoSamples = int(value)
+		aoSamplesLabel.SetText(fmt.Sprintf("samples (%d)", g.aoSamples))
+		aoSamplesSlider.Refresh()
+		g.Refresh()
 	}
 }
 
@@ -37,22 +189,61 @@ func animationButtonTapped(g *Game) func() {
 	}
 }
 
-func surfaceButtonTapped(g *Game) func() {
-	return func() {
-		if g.surface == "bezier" {
-			g.menu.surfaceButton.Text = "Hemisphere (currently)"
-		} else {
-			g.menu.surfaceButton.Text = "Bezier (currently)"
+func surfaceSelectChanged(g *Game) func(string) {
+	return func(label string) {
+		for _, entry := range surfaceRegistry {
+			if entry.label == label {
+				recordEdit(g.history, "surface", g.surface, entry.name, func(name string) {
+					for _, entry := range surfaceRegistry {
+						if entry.name == name {
+							g.menu.surfaceSelect.SetSelected(entry.label)
+						}
+					}
+				})
+				g.surface = entry.name
+				g.menu.updateSurfaceControls(g)
+				g.Refresh()
+				return
+			}
 		}
-		g.menu.surfaceButton.Refresh()
-		if g.surface == "bezier" {
-			g.surface = "hemisphere"
-		} else {
-			g.surface = "bezier"
+		panic("Invalid entry for surface select")
+	}
+}
+
+func brdfSelectChanged(g *Game) func(string) {
+	return func(label string) {
+		for _, entry := range brdfRegistry {
+			if entry.label == label {
+				recordEdit(g.history, "reflectance", g.brdf, entry.name, func(name string) {
+					for _, entry := range brdfRegistry {
+						if entry.name == name {
+							g.menu.brdfSelect.SetSelected(entry.label)
+						}
+					}
+				})
+				g.brdf = entry.name
+				g.menu.updateBRDFControls(g)
+				g.Refresh()
+				return
+			}
 		}
+		panic("Invalid entry for reflectance select")
 	}
 }
 
+// Loaded image with path of its file, as stored in history
+type imageFile struct {
+	image image.Image
+	path  string
+}
+
+func setNormalMap(g *Game, normalMapLabel *widget.Label, file imageFile) {
+	g.normalMap = file.image
+	g.normalMapPath = file.path
+	normalMapLabel.Text = fileLabelText(file.path)
+	normalMapLabel.Refresh()
+}
+
 func normalMapfileOpenCallback(g *Game, normalMapLabel *widget.Label) func(fyne.URIReadCloser, error) {
 	return func(urc fyne.URIReadCloser, err error) {
 		if err != nil {
@@ -61,12 +252,16 @@ func normalMapfileOpenCallback(g *Game, normalMapLabel *widget.Label) func(fyne.
 		if urc == nil {
 			return
 		}
-		g.normalMap, err = getImageFromFilePath(urc.URI().Path())
+		normalMap, err := getImageFromFilePath(urc.URI().Path())
 		if err != nil {
 			panic(err)
 		}
-		normalMapLabel.Text = "file: " + urc.URI().Name()
-		normalMapLabel.Refresh()
+		oldFile := imageFile{g.normalMap, g.normalMapPath}
+		newFile := imageFile{normalMap, urc.URI().Path()}
+		recordEdit(g.history, "normalMap", oldFile, newFile, func(file imageFile) {
+			setNormalMap(g, normalMapLabel, file)
+		})
+		setNormalMap(g, normalMapLabel, newFile)
 	}
 }
 
@@ -76,12 +271,73 @@ func normalMapButtonTapped(g *Game, normalMapLabel *widget.Label) func() {
 	}
 }
 
+// Loaded environment with path of its file, as stored in history
+type environmentFile struct {
+	environment *environment
+	path        string
+}
+
+func setEnvironment(g *Game, environmentLabel *widget.Label, file environmentFile) {
+	g.environment = file.environment
+	g.environmentPath = file.path
+	environmentLabel.Text = fileLabelText(file.path)
+	environmentLabel.Refresh()
+}
+
+func editEnvironment(g *Game, environmentLabel *widget.Label, file environmentFile) {
+	oldFile := environmentFile{g.environment, g.environmentPath}
+	recordEdit(g.history, "environment", oldFile, file, func(file environmentFile) {
+		setEnvironment(g, environmentLabel, file)
+	})
+	setEnvironment(g, environmentLabel, file)
+}
+
+func environmentFileOpenCallback(g *Game, environmentLabel *widget.Label) func(fyne.URIReadCloser, error) {
+	return func(urc fyne.URIReadCloser, err error) {
+		if err != nil {
+			panic(err)
+		}
+		if urc == nil {
+			return
+		}
+		defer urc.Close()
+		environment, err := loadEnvironment(urc.URI().Path())
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		editEnvironment(g, environmentLabel, environmentFile{environment, urc.URI().Path()})
+	}
+}
+
+func environmentButtonTapped(g *Game, environmentLabel *widget.Label) func() {
+	return func() {
+		dialog.ShowFileOpen(environmentFileOpenCallback(g, environmentLabel), g.window)
+	}
+}
+
+func removeEnvironmentButtonTapped(g *Game, environmentLabel *widget.Label) func() {
+	return func() {
+		if g.environment == nil {
+			return
+		}
+		editEnvironment(g, environmentLabel, environmentFile{})
+	}
+}
+
+func setBackgroundSolidColor(g *Game, backgroundSolidColorLabel *widget.Label, c color.Color) {
+	g.backgroundSolidColor = c
+	red, green, blue, _ := draw.ColorRGBA(g.backgroundSolidColor)
+	backgroundSolidColorLabel.Text = fmt.Sprintf("color: (%d, %d, %d)", red, green, blue)
+	backgroundSolidColorLabel.Refresh()
+}
+
 func backgroundSolidColorPickerCallback(g *Game, backgroundSolidColorLabel *widget.Label) func(color.Color) {
 	return func(c color.Color) {
-		g.backgroundSolidColor = c
-		r, g, b, _ := draw.ColorRGBA(g.backgroundSolidColor)
-		backgroundSolidColorLabel.Text = fmt.Sprintf("color: (%d, %d, %d)", r, g, b)
-		backgroundSolidColorLabel.Refresh()
+		recordEdit(g.history, "backgroundSolidColor", g.backgroundSolidColor, c, func(c color.Color) {
+			setBackgroundSolidColor(g, backgroundSolidColorLabel, c)
+		})
+		setBackgroundSolidColor(g, backgroundSolidColorLabel, c)
 	}
 }
 
@@ -99,15 +355,26 @@ func backgroundImagefileOpenCallback(g *Game, backgroundImageLabel *widget.Label
 		if urc == nil {
 			return
 		}
-		g.backgroundImage, err = getImageFromFilePath(urc.URI().Path())
+		backgroundImage, err := getImageFromFilePath(urc.URI().Path())
 		if err != nil {
 			panic(err)
 		}
-		backgroundImageLabel.Text = "file: " + urc.URI().Name()
-		backgroundImageLabel.Refresh()
+		oldFile := imageFile{g.backgroundImage, g.backgroundImagePath}
+		newFile := imageFile{backgroundImage, urc.URI().Path()}
+		recordEdit(g.history, "backgroundImage", oldFile, newFile, func(file imageFile) {
+			setBackgroundImage(g, backgroundImageLabel, file)
+		})
+		setBackgroundImage(g, backgroundImageLabel, newFile)
 	}
 }
 
+func setBackgroundImage(g *Game, backgroundImageLabel *widget.Label, file imageFile) {
+	g.backgroundImage = file.image
+	g.backgroundImagePath = file.path
+	backgroundImageLabel.Text = fileLabelText(file.path)
+	backgroundImageLabel.Refresh()
+}
+
 func backgroundImageButtonTapped(g *Game, backgroundImageLabel *widget.Label) func() {
 	return func() {
 		dialog.ShowFileOpen(backgroundImagefileOpenCallback(g, backgroundImageLabel), g.window)
@@ -115,7 +382,10 @@ func backgroundImageButtonTapped(g *Game, backgroundImageLabel *widget.Label) fu
 }
 
 func backgroundRadioButtonChanged(g *Game, backgroundRadioButton *widget.RadioGroup) func(string) {
+	oldOption := backgroundRadioButton.Selected
 	return func(option string) {
+		recordEdit(g.history, "isBackgroundSolidColor", oldOption, option, backgroundRadioButton.SetSelected)
+		oldOption = option
 		backgroundRadioButton.SetSelected(option)
 		backgroundRadioButton.Refresh()
 		if option == "Solid color" {
@@ -138,9 +408,10 @@ func backgroundRadioButtonChanged(g *Game, backgroundRadioButton *widget.RadioGr
 
 func triangulationSliderChanged(g *Game, triangulationSlider *widget.Slider) func(float64) {
 	return func(value float64) {
+		recordEdit(g.history, "triangulation", float64(g.triangulation), value, triangulationSlider.SetValue)
 		triangulationSlider.Value = value
 		g.triangulation = int(value)
-		g.triangles = makeTriangles(g.config, g.points, g.triangulation)
+		g.triangles = makeTriangles(g.points, g.patchDegree, g.triangulation)
 		triangulationSlider.Refresh()
 		g.Refresh()
 	}
@@ -148,6 +419,7 @@ func triangulationSliderChanged(g *Game, triangulationSlider *widget.Slider) fun
 
 func alphaSliderChanged(g *Game, alphaSlider *widget.Slider) func(float64) {
 	return func(value float64) {
+		recordEdit(g.history, "alpha", g.alpha, value, alphaSlider.SetValue)
 		alphaSlider.Value = value
 		g.alpha = value
 		alphaSlider.Refresh()
@@ -157,6 +429,7 @@ func alphaSliderChanged(g *Game, alphaSlider *widget.Slider) func(float64) {
 
 func betaSliderChanged(g *Game, betaSlider *widget.Slider) func(float64) {
 	return func(value float64) {
+		recordEdit(g.history, "beta", g.beta, value, betaSlider.SetValue)
 		betaSlider.Value = value
 		g.beta = value
 		betaSlider.Refresh()
@@ -164,16 +437,120 @@ func betaSliderChanged(g *Game, betaSlider *widget.Slider) func(float64) {
 	}
 }
 
+func zoomSliderChanged(g *Game, zoomSlider *widget.Slider) func(float64) {
+	return func(value float64) {
+		recordEdit(g.history, "zoom", g.zoom, value, zoomSlider.SetValue)
+		zoomSlider.Value = value
+		g.zoom = value
+		zoomSlider.Refresh()
+		g.Refresh()
+	}
+}
+
+func fovSliderChanged(g *Game, fovLabel *widget.Label, fovSlider *widget.Slider) func(float64) {
+	return func(value float64) {
+		recordEdit(g.history, "fov", g.fov, value, fovSlider.SetValue)
+		fovSlider.Value = value
+		g.fov = value
+		fovLabel.SetText(fmt.Sprintf("field of view (%0.0f)", value))
+		fovSlider.Refresh()
+		g.Refresh()
+	}
+}
+
+func projectionRadioButtonChanged(g *Game, projectionRadioButton *widget.RadioGroup) func(string) {
+	oldOption := projectionRadioButton.Selected
+	return func(option string) {
+		recordEdit(g.history, "projection", oldOption, option, projectionRadioButton.SetSelected)
+		oldOption = option
+		if option == "Orthographic" {
+			g.projection = projectionOrthographic
+		} else if option == "Perspective" {
+			g.projection = projectionPerspective
+		} else {
+			panic("Invalid entry for projection radio button")
+		}
+		g.Refresh()
+	}
+}
+
+func shadingRadioButtonChanged(g *Game, shadingRadioButton *widget.RadioGroup) func(string) {
+	oldOption := shadingRadioButton.Selected
+	return func(option string) {
+		recordEdit(g.history, "shading", oldOption, option, shadingRadioButton.SetSelected)
+		oldOption = option
+		if option == "Flat" {
+			g.shading = shadingFlat
+		} else if option == "Gouraud" {
+			g.shading = shadingGouraud
+		} else if option == "Phong" {
+			g.shading = shadingPhong
+		} else {
+			panic("Invalid entry for shading radio button")
+		}
+		g.Refresh()
+	}
+}
+
+func toneMappingRadioButtonChanged(g *Game, toneMappingRadioButton *widget.RadioGroup) func(string) {
+	oldOption := toneMappingRadioButton.Selected
+	return func(option string) {
+		recordEdit(g.history, "toneMapping", oldOption, option, toneMappingRadioButton.SetSelected)
+		oldOption = option
+		if option == "Clamp" {
+			g.toneMapping = toneMappingClamp
+		} else if option == "Reinhard" {
+			g.toneMapping = toneMappingReinhard
+		} else if option == "ACES" {
+			g.toneMapping = toneMappingACES
+		} else {
+			panic("Invalid entry for tone mapping radio button")
+		}
+		g.Refresh()
+	}
+}
+
+// Set camera orientation, position and zoom together with sliders showing
+// them, without recording edits in history
+func setView(g *Game, view viewState) {
+	g.alpha = view.alpha
+	g.beta = view.beta
+	g.pan = view.pan
+	g.zoom = view.zoom
+	g.menu.alphaSlider.Value = view.alpha
+	g.menu.alphaSlider.Refresh()
+	g.menu.betaSlider.Value = view.beta
+	g.menu.betaSlider.Refresh()
+	g.menu.zoomSlider.Value = view.zoom
+	g.menu.zoomSlider.Refresh()
+	g.Refresh()
+}
+
+func resetViewButtonTapped(g *Game) func() {
+	return func() {
+		view := viewState{alpha: 0, beta: 0, pan: Vec{0, 0, 0}, zoom: 1}
+		recordEdit(g.history, "view", g.view(), view, func(view viewState) {
+			setView(g, view)
+		})
+		setView(g, view)
+	}
+}
+
 func pointsHeightSliderChanged(g *Game, pointsHeightSlider *widget.Slider) func(float64) {
 	return func(value float64) {
 		if g.pointHeight != nil {
+			oldPointsHeight := copyGrid(g.pointsHeight)
 			for points_row_index := range g.points {
 				for point_index, point := range g.points[points_row_index] {
 					if point == g.pointHeight {
-						g.pointsHeight[points_row_index][point_index] = value
+						setControlValue(g.pointsHeight, points_row_index, point_index, value, g.patchDegree, g.editContinuity())
 					}
 				}
 			}
+			recordEdit(g.history, "pointsHeight", oldPointsHeight, copyGrid(g.pointsHeight), func(pointsHeight [][]float64) {
+				restoreGrid(g.pointsHeight, pointsHeight)
+				g.Refresh()
+			})
 			pointsHeightSlider.Value = value
 		} else {
 			pointsHeightSlider.Value = 0
@@ -183,8 +560,373 @@ func pointsHeightSliderChanged(g *Game, pointsHeightSlider *widget.Slider) func(
 	}
 }
 
+// Debug views aren't scene edits, so they aren't recorded in history
+func debugViewSelectChanged(g *Game) func(string) {
+	return func(option string) {
+		if option == "Shaded" {
+			g.debugView = debugViewShaded
+		} else if option == "Depth" {
+			g.debugView = debugViewDepth
+		} else if option == "Ambient occlusion" {
+			g.debugView = debugViewAO
+		} else {
+			panic("Invalid entry for debug view select")
+		}
+		g.Refresh()
+	}
+}
+
 func triangulationCheckChanged(g *Game) func(bool) {
 	return func(value bool) {
 		g.showMesh = value
 	}
 }
+
+// Continuity with control points it affects, as stored in history
+type continuityState struct {
+	option       string
+	pointsHeight [][]float64
+	points       [][]geom.Point
+}
+
+func continuityRadioButtonChanged(g *Game, continuityRadioButton *widget.RadioGroup) func(string) {
+	oldOption := continuityRadioButton.Selected
+	return func(option string) {
+		oldState := continuityState{oldOption, copyGrid(g.pointsHeight), copyPoints(g.points)}
+		oldOption = option
+		defer func() {
+			newState := continuityState{option, copyGrid(g.pointsHeight), copyPoints(g.points)}
+			recordEdit(g.history, "continuity", oldState, newState, func(state continuityState) {
+				continuityRadioButton.SetSelected(state.option)
+				restoreGrid(g.pointsHeight, state.pointsHeight)
+				restorePoints(g.points, state.points)
+				g.triangles = makeTriangles(g.points, g.patchDegree, g.triangulation)
+				g.Refresh()
+			})
+		}()
+		if option == "C0" {
+			g.continuity = continuityC0
+		} else if option == "C1" {
+			g.continuity = continuityC1
+			enforceC1(g.pointsHeight, g.patchDegree)
+			enforcePointsC1(g.points, g.patchDegree)
+			g.triangles = makeTriangles(g.points, g.patchDegree, g.triangulation)
+		} else {
+			panic("Invalid entry for continuity radio button")
+		}
+		g.Refresh()
+	}
+}
+
+func pointsWeightSliderChanged(g *Game, pointsWeightSlider *widget.Slider) func(float64) {
+	return func(value float64) {
+		if g.pointHeight != nil {
+			oldPointsWeight := copyGrid(g.pointsWeight)
+			for points_row_index := range g.points {
+				for point_index, point := range g.points[points_row_index] {
+					if point == g.pointHeight {
+						g.pointsWeight[points_row_index][point_index] = value
+					}
+				}
+			}
+			recordEdit(g.history, "pointsWeight", oldPointsWeight, copyGrid(g.pointsWeight), func(pointsWeight [][]float64) {
+				restoreGrid(g.pointsWeight, pointsWeight)
+				g.Refresh()
+			})
+			pointsWeightSlider.Value = value
+		} else {
+			pointsWeightSlider.Value = 1
+		}
+		pointsWeightSlider.Refresh()
+		g.Refresh()
+	}
+}
+
+func knotsEntrySubmitted(g *Game, knots *[]float64, field string, knotsEntry *widget.Entry) func(string) {
+	return func(text string) {
+		newKnots, err := parseKnots(text)
+		if err == nil {
+			err = validateKnots(newKnots, len(g.pointsHeight), g.splineDegree)
+		}
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		recordEdit(g.history, field, *knots, newKnots, func(value []float64) {
+			*knots = value
+			knotsEntry.SetText(formatKnots(value))
+			g.Refresh()
+		})
+		*knots = newKnots
+		g.Refresh()
+	}
+}
+
+func knotsButtonTapped(g *Game, makeKnots func(count, degree int) []float64) func() {
+	setKnots := func(knots [2][]float64) {
+		g.knotsU = knots[0]
+		g.knotsV = knots[1]
+		g.menu.knotsUEntry.SetText(formatKnots(g.knotsU))
+		g.menu.knotsVEntry.SetText(formatKnots(g.knotsV))
+		g.Refresh()
+	}
+	return func() {
+		oldKnots := [2][]float64{g.knotsU, g.knotsV}
+		newKnots := [2][]float64{
+			makeKnots(len(g.pointsHeight), g.splineDegree),
+			makeKnots(len(g.pointsHeight[0]), g.splineDegree),
+		}
+		recordEdit(g.history, "knots", oldKnots, newKnots, setKnots)
+		setKnots(newKnots)
+	}
+}
+
+func surfaceFileOpenCallback(g *Game, fileSurface FileSurface, surfaceFileLabel *widget.Label) func(fyne.URIReadCloser, error) {
+	return func(urc fyne.URIReadCloser, err error) {
+		if err != nil {
+			panic(err)
+		}
+		if urc == nil {
+			return
+		}
+		img, err := getImageFromFilePath(urc.URI().Path())
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		fileSurface.SetImage(urc.URI().Path(), img)
+		surfaceFileLabel.Text = "file: " + urc.URI().Name()
+		surfaceFileLabel.Refresh()
+		g.Refresh()
+	}
+}
+
+func surfaceFileButtonTapped(g *Game, fileSurface FileSurface, surfaceFileLabel *widget.Label) func() {
+	return func() {
+		dialog.ShowFileOpen(surfaceFileOpenCallback(g, fileSurface, surfaceFileLabel), g.window)
+	}
+}
+
+func paramSliderChanged(g *Game, name string, param Param, paramLabel *widget.Label, paramSlider *widget.Slider) func(float64) {
+	return func(value float64) {
+		recordEdit(g.history, name+" "+param.Name, *param.Value, value, paramSlider.SetValue)
+		*param.Value = value
+		paramLabel.Text = fmt.Sprintf("%s (%0.2f)", param.Name, value)
+		paramLabel.Refresh()
+		g.Refresh()
+	}
+}
+
+func dragModeRadioButtonChanged(g *Game) func(string) {
+	return func(option string) {
+		if option == "Light" {
+			g.dragMode = dragModeLight
+		} else if option == "Control points" {
+			g.dragMode = dragModePoints
+		} else if option == "Orbit" {
+			g.dragMode = dragModeOrbit
+		} else if option == "Pan" {
+			g.dragMode = dragModePan
+		} else {
+			panic("Invalid entry for drag mode radio button")
+		}
+	}
+}
+
+// Record edits of slider bound to data in history, slider's OnChanged is
+// used by binding, so edits are recorded once user stops moving slider
+func recordBoundSliderEdits(g *Game, slider *widget.Slider, field string, value float64) {
+	oldValue := value
+	slider.OnChangeEnded = func(value float64) {
+		// binding sets slider to initial value too
+		if value == oldValue {
+			return
+		}
+		recordEdit(g.history, field, oldValue, value, slider.SetValue)
+		oldValue = value
+	}
+}
+
+func undoButtonTapped(g *Game) func() {
+	return func() {
+		g.history.Undo()
+		g.Refresh()
+	}
+}
+
+func redoButtonTapped(g *Game) func() {
+	return func() {
+		g.history.Redo()
+		g.Refresh()
+	}
+}
+
+func historyListSelected(g *Game, historyList *widget.List) func(widget.ListItemID) {
+	return func(id widget.ListItemID) {
+		g.history.GoTo(id + 1)
+		historyList.UnselectAll()
+		g.Refresh()
+	}
+}
+
+func saveSceneFileCallback(g *Game) func(fyne.URIWriteCloser, error) {
+	return func(uwc fyne.URIWriteCloser, err error) {
+		if err != nil {
+			panic(err)
+		}
+		if uwc == nil {
+			return
+		}
+		defer uwc.Close()
+		err = g.sceneFile(uwc.URI().Path()).Save(uwc)
+		if err != nil {
+			dialog.ShowError(err, g.window)
+		}
+	}
+}
+
+func saveSceneButtonTapped(g *Game) func() {
+	return func() {
+		dialog.ShowFileSave(saveSceneFileCallback(g), g.window)
+	}
+}
+
+func openSceneFileCallback(g *Game) func(fyne.URIReadCloser, error) {
+	return func(urc fyne.URIReadCloser, err error) {
+		if err != nil {
+			panic(err)
+		}
+		if urc == nil {
+			return
+		}
+		defer urc.Close()
+		scene, err := scenefile.Load(urc)
+		if err == nil {
+			err = g.loadSceneFile(scene, urc.URI().Path())
+		}
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		// widgets are rebuilt to show loaded values, old history refers to
+		// old widgets and scene, so it is dropped
+		g.pointHeight = nil
+		g.lightIndex = 0
+		g.history = NewHistory()
+		g.window.SetContent(g.BuildUI())
+		g.Refresh()
+	}
+}
+
+func openSceneButtonTapped(g *Game) func() {
+	return func() {
+		dialog.ShowFileOpen(openSceneFileCallback(g), g.window)
+	}
+}
+
+func exportImageFileCallback(g *Game, width, height, samples int, format string, quality int) func(fyne.URIWriteCloser, error) {
+	return func(uwc fyne.URIWriteCloser, err error) {
+		if err != nil {
+			panic(err)
+		}
+		if uwc == nil {
+			return
+		}
+		defer uwc.Close()
+		if isHDRImageFormat(format) {
+			err = encodeHDRImage(uwc, g.RenderHDRSupersampled(width, height, samples), format)
+		} else {
+			err = encodeImage(uwc, g.RenderSupersampled(width, height, samples), format, quality)
+		}
+		if err != nil {
+			dialog.ShowError(err, g.window)
+		}
+	}
+}
+
+func exportImageButtonTapped(g *Game) func() {
+	return func() {
+		formatSelect := widget.NewSelect(imageFormats, nil)
+		formatSelect.SetSelected(imageFormatPNG)
+		sizeEntry := widget.NewEntry()
+		sizeEntry.SetText(fmt.Sprintf("%dx%d", g.config.UI.RasterWidth, g.config.UI.RasterHeight))
+		sizeEntry.Validator = func(text string) error {
+			_, _, err := parseSize(text)
+			return err
+		}
+		samplesSelect := widget.NewSelect([]string{"1", "2", "3", "4", "8"}, nil)
+		samplesSelect.SetSelected(fmt.Sprint(g.config.Defaults.ExportSupersampling))
+		qualitySlider := widget.NewSlider(1, 100)
+		qualitySlider.SetValue(float64(g.config.Defaults.JPEGQuality))
+
+		items := []*widget.FormItem{
+			widget.NewFormItem("format", formatSelect),
+			widget.NewFormItem("size (WxH)", sizeEntry),
+			widget.NewFormItem("supersampling", samplesSelect),
+			widget.NewFormItem("JPEG quality", qualitySlider),
+		}
+		dialog.ShowForm("Export image", "Export", "Cancel", items, func(ok bool) {
+			if !ok {
+				return
+			}
+			width, height, _ := parseSize(sizeEntry.Text)
+			var samples int
+			fmt.Sscan(samplesSelect.Selected, &samples)
+			format := formatSelect.Selected
+			callback := exportImageFileCallback(g, width, height, samples, format, int(qualitySlider.Value))
+			fileDialog := dialog.NewFileSave(callback, g.window)
+			fileDialog.SetFileName("frame" + imageFormatExtensions[format])
+			fileDialog.Show()
+		}, g.window)
+	}
+}
+
+func exportMeshFileCallback(g *Game, triangulation int, format string, withLight bool) func(fyne.URIWriteCloser, error) {
+	return func(uwc fyne.URIWriteCloser, err error) {
+		if err != nil {
+			panic(err)
+		}
+		if uwc == nil {
+			return
+		}
+		// file is written by path, so that OBJ material can be saved next
+		// to it
+		uwc.Close()
+		err = g.saveMeshToFilePath(uwc.URI().Path(), triangulation, format, withLight)
+		if err != nil {
+			dialog.ShowError(err, g.window)
+		}
+	}
+}
+
+func exportMeshButtonTapped(g *Game) func() {
+	return func() {
+		formatSelect := widget.NewSelect(meshFormats, nil)
+		formatSelect.SetSelected(meshFormatOBJ)
+		triangulationLabel := widget.NewLabel("")
+		triangulationSlider := widget.NewSlider(1, 50)
+		triangulationSlider.Step = 1
+		triangulationSlider.OnChanged = func(value float64) {
+			triangulationLabel.SetText(fmt.Sprintf("triangulation (%0.0f)", value))
+		}
+		triangulationSlider.SetValue(float64(g.triangulation))
+		lightCheck := widget.NewCheck("export light (glTF only)", nil)
+
+		items := []*widget.FormItem{
+			widget.NewFormItem("format", formatSelect),
+			widget.NewFormItem("", triangulationLabel),
+			widget.NewFormItem("", triangulationSlider),
+			widget.NewFormItem("", lightCheck),
+		}
+		dialog.ShowForm("Export mesh", "Export", "Cancel", items, func(ok bool) {
+			if !ok {
+				return
+			}
+			format := formatSelect.Selected
+			callback := exportMeshFileCallback(g, int(triangulationSlider.Value), format, lightCheck.Checked)
+			fileDialog := dialog.NewFileSave(callback, g.window)
+			fileDialog.SetFileName("surface" + meshFormatExtensions[format])
+			fileDialog.Show()
+		}, g.window)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zeraye/bezier-shading/pkg/draw"
+	"github.com/zeraye/bezier-shading/pkg/mesh"
+	"github.com/zeraye/bezier-shading/pkg/scenefile"
+)
+
+// Formats mesh can be exported to
+const (
+	meshFormatOBJ      = "OBJ"
+	meshFormatSTL      = "STL"
+	meshFormatSTLASCII = "STL ASCII"
+	meshFormatPLY      = "PLY"
+	meshFormatGLB      = "glTF binary"
+)
+
+var meshFormats = []string{meshFormatOBJ, meshFormatSTL, meshFormatSTLASCII, meshFormatPLY, meshFormatGLB}
+
+// File extension of every mesh format
+var meshFormatExtensions = map[string]string{
+	meshFormatOBJ:      ".obj",
+	meshFormatSTL:      ".stl",
+	meshFormatSTLASCII: ".stl",
+	meshFormatPLY:      ".ply",
+	meshFormatGLB:      ".glb",
+}
+
+// Tessellate surface into mesh, triangulation is number of squares (made of
+// two triangles) at the side of every cell of control points grid, the same
+// as in makeTriangles. Raster is mapped onto unit square with y axis pointing
+// up and z axis being surface height.
+func (s *Scene) Mesh(triangulation int) *mesh.Mesh {
+	rows := (len(s.points) - 1) * triangulation
+	cols := (len(s.points[0]) - 1) * triangulation
+	width := float64(s.config.UI.RasterWidth)
+	height := float64(s.config.UI.RasterHeight)
+
+	m := &mesh.Mesh{}
+	for i := 0; i <= rows; i++ {
+		for j := 0; j <= cols; j++ {
+			u := float64(i) / float64(rows)
+			v := float64(j) / float64(cols)
+			p := planePoint(u, v, s.points, s.patchDegree)
+			sp := s.surfaces[s.surface].Eval(s, p.X, p.Y, u, v)
+			// raster y axis points down, so y coordinates are flipped
+			x := p.X / width
+			y := 1 - p.Y/height
+			m.Vertices = append(m.Vertices, mesh.Vertex{
+				Position: [3]float64{x, y, sp.Z},
+				Normal:   [3]float64{sp.Normal.x, -sp.Normal.y, sp.Normal.z},
+				UV:       [2]float64{x, y},
+			})
+		}
+	}
+
+	index := func(i, j int) int {
+		return i*(cols+1) + j
+	}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			// the same triangles as in makeTriangles, with order of vertices
+			// reversed by flipping y axis
+			m.Triangles = append(m.Triangles,
+				[3]int{index(i, j), index(i, j+1), index(i+1, j)},
+				[3]int{index(i+1, j), index(i, j+1), index(i+1, j+1)},
+			)
+		}
+	}
+	return m
+}
+
+// Material matching scene shading with colors in linear light, texture paths
+// are relative to mtlPath
+func (s *Scene) meshMaterial(mtlPath string) mesh.Material {
+	material := mesh.Material{Name: "surface", Shininess: s.m}
+	color := [3]float64{1, 1, 1}
+	if s.isBackgroundSolidColor || s.backgroundImage == nil {
+		r, g, b := draw.ColorLinearRGB(s.backgroundSolidColor)
+		color = [3]float64{r, g, b}
+	} else {
+		material.DiffuseTexture = scenefile.RelativePath(mtlPath, s.backgroundImagePath)
+	}
+	ar, ag, ab := draw.ColorLinearRGB(s.ambientColor)
+	ambient := [3]float64{ar, ag, ab}
+	for i := range color {
+		material.Ambient[i] = s.ka * ambient[i] * color[i]
+		material.Diffuse[i] = s.kd * color[i]
+		material.Specular[i] = s.ks * color[i]
+	}
+	if s.normalMap != nil {
+		material.NormalTexture = scenefile.RelativePath(mtlPath, s.normalMapPath)
+	}
+	return material
+}
+
+// Mesh format of file chosen by its extension, ASCII STL is chosen if ascii
+// is true
+func meshFormatFromPath(filePath string, ascii bool) (string, error) {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".obj":
+		return meshFormatOBJ, nil
+	case ".stl":
+		if ascii {
+			return meshFormatSTLASCII, nil
+		}
+		return meshFormatSTL, nil
+	case ".ply":
+		return meshFormatPLY, nil
+	case ".glb":
+		return meshFormatGLB, nil
+	}
+	return "", fmt.Errorf("unsupported mesh file extension %q", filepath.Ext(filePath))
+}
+
+// Point in mesh coordinates (see Mesh), heights are compared with surface
+// height multiplied by 100 when shading
+func (s *Scene) meshPoint(p Vec) [3]float64 {
+	return [3]float64{
+		p.x / float64(s.config.UI.RasterWidth),
+		1 - p.y/float64(s.config.UI.RasterHeight),
+		p.z / 100,
+	}
+}
+
+// Enabled lights in mesh coordinates. Intensity of point and spot lights
+// gives irradiance equal to light intensity on the ground below them.
+func (s *Scene) meshLights() []mesh.Light {
+	lights := []mesh.Light{}
+	target := s.meshPoint(s.lightTarget())
+	for _, light := range s.lights {
+		if !light.enabled {
+			continue
+		}
+		r, g, b := draw.ColorLinearRGB(light.color)
+		position := s.meshPoint(light.position())
+		direction := normalize(Vec{target[0] - position[0], target[1] - position[1], target[2] - position[2]})
+		meshLight := mesh.Light{
+			Type:      "point",
+			Position:  position,
+			Direction: [3]float64{direction.x, direction.y, direction.z},
+			Color:     [3]float64{r, g, b},
+			Intensity: position[2] * position[2] * light.intensity,
+		}
+		switch light.kind {
+		case lightTypeDirectional:
+			meshLight.Type = "directional"
+			meshLight.Intensity = light.intensity
+		case lightTypeSpot:
+			meshLight.Type = "spot"
+			meshLight.OuterConeAngle = light.coneAngle * math.Pi / 180
+			meshLight.InnerConeAngle = light.coneAngle * (1 - light.falloff) * math.Pi / 180
+		}
+		lights = append(lights, meshLight)
+	}
+	return lights
+}
+
+// Image encoded as PNG, so that it can be embedded into mesh file
+func pngTexture(img image.Image) (*mesh.Texture, error) {
+	var data bytes.Buffer
+	err := png.Encode(&data, img)
+	if err != nil {
+		return nil, err
+	}
+	return &mesh.Texture{MimeType: "image/png", Data: data.Bytes()}, nil
+}
+
+// Write surface mesh in glTF binary format with textures embedded, lights are
+// exported if withLight is true
+func (s *Scene) writeGLB(w io.Writer, m *mesh.Mesh, withLight bool) error {
+	// texture paths aren't used, images are embedded instead
+	material := s.meshMaterial("")
+	var diffuse, normal *mesh.Texture
+	var err error
+	if !s.isBackgroundSolidColor && s.backgroundImage != nil {
+		diffuse, err = pngTexture(s.backgroundImage)
+		if err != nil {
+			return err
+		}
+	}
+	if s.normalMap != nil {
+		normal, err = pngTexture(s.normalMap)
+		if err != nil {
+			return err
+		}
+	}
+	var lights []mesh.Light
+	if withLight {
+		lights = s.meshLights()
+	}
+	return mesh.WriteGLB(w, m, material, diffuse, normal, lights)
+}
+
+// Save surface mesh to file in given format, OBJ material is saved next to
+// it to file with .mtl extension. Lights are exported only to glTF and only if
+// withLight is true.
+func (s *Scene) saveMeshToFilePath(filePath string, triangulation int, format string, withLight bool) error {
+	m := s.Mesh(triangulation)
+	name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case meshFormatOBJ:
+		mtlPath := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + ".mtl"
+		material := s.meshMaterial(mtlPath)
+		err = mesh.WriteOBJ(f, m, filepath.Base(mtlPath), material.Name)
+		if err == nil {
+			err = saveMaterialToFilePath(mtlPath, material)
+		}
+	case meshFormatSTL:
+		err = mesh.WriteSTLBinary(f, m, name)
+	case meshFormatSTLASCII:
+		err = mesh.WriteSTL(f, m, name)
+	case meshFormatPLY:
+		err = mesh.WritePLY(f, m)
+	case meshFormatGLB:
+		err = s.writeGLB(f, m, withLight)
+	default:
+		err = fmt.Errorf("unsupported mesh format %q", format)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func saveMaterialToFilePath(filePath string, material mesh.Material) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	err = mesh.WriteMTL(f, material)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,15 @@
+package main
+
+// Adjustable parameter shown in menu as slider
+type Param struct {
+	Name  string
+	Min   float64
+	Max   float64
+	Step  float64
+	Value *float64
+}
+
+// Implemented by types with parameters adjustable from menu
+type Configurable interface {
+	Params() []Param
+}
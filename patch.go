@@ -0,0 +1,247 @@
+package main
+
+import (
+	"math"
+
+	"github.com/zeraye/bezier-shading/pkg/geom"
+)
+
+const (
+	continuityC0 = 0
+	continuityC1 = 1
+)
+
+// Number of control points per side for surface made of patches x patches
+// Bezier patches of given degree sharing their edges
+func patchesGridSize(patches, degree int) int {
+	return patches*degree + 1
+}
+
+// Find patch owning global (u, v), return its control points heights, local
+// (u, v) coordinates and number of patches in both directions (needed to
+// scale derivatives from local to global coordinates)
+func bezierPatch(u, v float64, pointsHeight [][]float64, degree int) ([][]float64, float64, float64, float64, float64) {
+	patchesU := (len(pointsHeight) - 1) / degree
+	patchesV := (len(pointsHeight[0]) - 1) / degree
+
+	i, localU := patchIndex(u, patchesU)
+	j, localV := patchIndex(v, patchesV)
+
+	patch := make([][]float64, degree+1)
+	for k := 0; k <= degree; k++ {
+		patch[k] = pointsHeight[i*degree+k][j*degree : j*degree+degree+1]
+	}
+	return patch, localU, localV, float64(patchesU), float64(patchesV)
+}
+
+// Index of patch owning t and t in patch local coordinates
+func patchIndex(t float64, patches int) (int, float64) {
+	index := int(math.Floor(t * float64(patches)))
+	if index < 0 {
+		index = 0
+	}
+	if index > patches-1 {
+		index = patches - 1
+	}
+	return index, t*float64(patches) - float64(index)
+}
+
+func patchesBezier(u, v float64, pointsHeight [][]float64, degree int) Vec {
+	patch, localU, localV, _, _ := bezierPatch(u, v, pointsHeight, degree)
+	vec := bezier(localU, localV, patch)
+	return Vec{u, v, vec.z}
+}
+
+func patchesBezierDU(u, v float64, pointsHeight [][]float64, degree int) Vec {
+	patch, localU, localV, patchesU, _ := bezierPatch(u, v, pointsHeight, degree)
+	vec := bezierDU(localU, localV, patch)
+	return Vec{1, 0, vec.z * patchesU}
+}
+
+func patchesBezierDV(u, v float64, pointsHeight [][]float64, degree int) Vec {
+	patch, localU, localV, _, patchesV := bezierPatch(u, v, pointsHeight, degree)
+	vec := bezierDV(localU, localV, patch)
+	return Vec{0, 1, vec.z * patchesV}
+}
+
+// Set value (height or coordinate) of control point (i, j). With C1
+// continuity points on the other side of shared patch edge are moved, so that
+// tangents stay continuous in both directions. C0 continuity is guaranteed by
+// patches sharing edge control points.
+func setControlValue(pointsHeight [][]float64, i, j int, value float64, degree, continuity int) {
+	delta := value - pointsHeight[i][j]
+	if continuity != continuityC1 || degree < 2 {
+		pointsHeight[i][j] = value
+		return
+	}
+
+	// point on shared edge moves together with its neighbours across it, at
+	// shared corner it is whole 3x3 block
+	firstRow, lastRow := movedLines(i, len(pointsHeight)-1, degree)
+	firstColumn, lastColumn := movedLines(j, len(pointsHeight[i])-1, degree)
+	for r := firstRow; r <= lastRow; r++ {
+		for c := firstColumn; c <= lastColumn; c++ {
+			pointsHeight[r][c] += delta
+		}
+	}
+
+	// moved columns are mirrored across shared row edges first, then every
+	// changed row across shared column edges. Mirroring is linear, so edges
+	// which were continuous stay continuous.
+	rows := mirrorLines(firstRow, lastRow, len(pointsHeight)-1, degree, func(to, edge, from int) {
+		for c := firstColumn; c <= lastColumn; c++ {
+			pointsHeight[to][c] = 2*pointsHeight[edge][c] - pointsHeight[from][c]
+		}
+	})
+	mirrorLines(firstColumn, lastColumn, len(pointsHeight[i])-1, degree, func(to, edge, from int) {
+		for _, r := range rows {
+			pointsHeight[r][to] = 2*pointsHeight[r][edge] - pointsHeight[r][from]
+		}
+	})
+}
+
+// Rows or columns (of lines 0 to last) moved together with line k: line on
+// shared patch edge moves with its neighbours
+func movedLines(k, last, degree int) (int, int) {
+	if k%degree == 0 && k > 0 && k < last {
+		return k - 1, k + 1
+	}
+	return k, k
+}
+
+// Lines changed with moved lines from first to last (of lines 0 to end).
+// Line next to shared edge is mirrored by mirror to the other side of it. For
+// degree 2 mirrored line is next to another shared edge, so mirroring goes on
+// up to the border of surface.
+func mirrorLines(first, last, end, degree int, mirror func(to, edge, from int)) []int {
+	lines := []int{}
+	for k := first; k <= last; k++ {
+		lines = append(lines, k)
+	}
+	for k := first; k%degree == 1 && k > 1; k -= 2 {
+		mirror(k-2, k-1, k)
+		lines = append(lines, k-2)
+	}
+	for k := last; k%degree == degree-1 && k+1 < end; k += 2 {
+		mirror(k+2, k+1, k)
+		lines = append(lines, k+2)
+	}
+	return lines
+}
+
+// Make whole surface C1 continuous by moving control points on shared
+// patch edges to the middle of their neighbours
+func enforceC1(pointsHeight [][]float64, degree int) {
+	if degree < 2 {
+		return
+	}
+	for i := degree; i < len(pointsHeight)-1; i += degree {
+		for j := range pointsHeight[i] {
+			pointsHeight[i][j] = (pointsHeight[i-1][j] + pointsHeight[i+1][j]) / 2
+		}
+	}
+	for i := range pointsHeight {
+		for j := degree; j < len(pointsHeight[i])-1; j += degree {
+			pointsHeight[i][j] = (pointsHeight[i][j-1] + pointsHeight[i][j+1]) / 2
+		}
+	}
+}
+
+// Control points coordinates as separate grids of x and y values
+func pointsCoordinates(points [][]*geom.Point) ([][]float64, [][]float64) {
+	xs := make([][]float64, len(points))
+	ys := make([][]float64, len(points))
+	for i := range points {
+		xs[i] = make([]float64, len(points[i]))
+		ys[i] = make([]float64, len(points[i]))
+		for j, point := range points[i] {
+			xs[i][j] = point.X
+			ys[i][j] = point.Y
+		}
+	}
+	return xs, ys
+}
+
+// Move control point (i, j) on raster, keeping continuity between patches
+func setPointPosition(points [][]*geom.Point, i, j int, x, y float64, degree, continuity int) {
+	xs, ys := pointsCoordinates(points)
+	setControlValue(xs, i, j, x, degree, continuity)
+	setControlValue(ys, i, j, y, degree, continuity)
+	for i := range points {
+		for j, point := range points[i] {
+			point.X = xs[i][j]
+			point.Y = ys[i][j]
+		}
+	}
+}
+
+// Make control points positions C1 continuous, see enforceC1
+func enforcePointsC1(points [][]*geom.Point, degree int) {
+	xs, ys := pointsCoordinates(points)
+	enforceC1(xs, degree)
+	enforceC1(ys, degree)
+	for i := range points {
+		for j, point := range points[i] {
+			point.X = xs[i][j]
+			point.Y = ys[i][j]
+		}
+	}
+}
+
+// Raster position of parametric point (u, v). Control points positions form
+// piecewise Bezier map the same way their heights form surface, so with
+// control points on regular grid it is identity (scaled to raster size).
+func planePoint(u, v float64, points [][]*geom.Point, degree int) *geom.Point {
+	i, localU := patchIndex(u, (len(points)-1)/degree)
+	j, localV := patchIndex(v, (len(points[0])-1)/degree)
+	x, y := 0.0, 0.0
+	for k := 0; k <= degree; k++ {
+		for l := 0; l <= degree; l++ {
+			point := points[i*degree+k][j*degree+l]
+			basis := b(k, degree, localU) * b(l, degree, localV)
+			x += point.X * basis
+			y += point.Y * basis
+		}
+	}
+	return geom.NewPoint(x, y)
+}
+
+// Derivative of Bernstein polynomial b(i, n, t) with respect to t
+func bDerivative(i, n int, t float64) float64 {
+	d := 0.0
+	if i > 0 {
+		d += b(i-1, n-1, t)
+	}
+	if i < n {
+		d -= b(i, n-1, t)
+	}
+	return float64(n) * d
+}
+
+// Derivatives of planePoint with respect to u and v, divided by raster size,
+// so that for control points on regular grid they are (1, 0) and (0, 1)
+func planeDerivatives(u, v float64, points [][]*geom.Point, degree int, width, height float64) (Vec, Vec) {
+	patchesU, patchesV := (len(points)-1)/degree, (len(points[0])-1)/degree
+	i, localU := patchIndex(u, patchesU)
+	j, localV := patchIndex(v, patchesV)
+	du, dv := Vec{}, Vec{}
+	for k := 0; k <= degree; k++ {
+		for l := 0; l <= degree; l++ {
+			point := points[i*degree+k][j*degree+l]
+			basisU := bDerivative(k, degree, localU) * b(l, degree, localV) * float64(patchesU)
+			basisV := b(k, degree, localU) * bDerivative(l, degree, localV) * float64(patchesV)
+			du = add(du, Vec{point.X * basisU / width, point.Y * basisU / height, 0})
+			dv = add(dv, Vec{point.X * basisV / width, point.Y * basisV / height, 0})
+		}
+	}
+	return du, dv
+}
+
+// Normal of surface with height derivatives zu and zv at (u, v). Tangents
+// follow raster positions of control points, so that surface is shaded the
+// way it is drawn after points are moved out of regular grid.
+func (s *Scene) planeNormal(u, v, zu, zv float64) Vec {
+	du, dv := planeDerivatives(u, v, s.points, s.patchDegree, float64(s.config.UI.RasterWidth), float64(s.config.UI.RasterHeight))
+	du.z, dv.z = zu, zv
+	return normalize(crossProduct(du, dv))
+}
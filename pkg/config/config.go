@@ -29,18 +29,44 @@ type UIConfig struct {
 	RasterBorderColorRGBA        [4]uint8
 	RasterWidth                  int
 	RasterHeight                 int
+	RenderTileSize               int // side of square tiles rendered image is split into
 }
 
 type DefaultsConfig struct {
 	Kd                              float64 // coefficient describing the impact of a given component on the result (0-1)
 	Ks                              float64 // coefficient describing the impact of a given component on the result (0-1)
 	M                               float64 // coefficient describing how much a given triangle is changed (1-100)
+	Ka                              float64 // coefficient of ambient light (0-1)
+	AmbientColorRGBA                [4]uint8
 	LightColorRGBA                  [4]uint8
 	LightAnimation                  bool
 	LightHeight                     float64
+	LightAttenuation                [3]float64 // constant, linear and quadratic coefficients of light attenuation with distance
+	Shadows                         bool       // surface casts shadows
+	ShadowBias                      float64    // height by which surface has to be above shadow ray to block it
+	ShadowLightRadius               float64    // radius of lights casting soft shadows, 0 for hard shadows
+	ShadowSamples                   int        // number of points of light sampled for soft shadows
+	AmbientOcclusion                bool       // surface around point blocks ambient and diffuse light
+	AORadius                        float64    // distance from point within which surface is sampled for ambient occlusion
+	AOSamples                       int        // number of points sampled for ambient occlusion
+	AOStrength                      float64    // how much fully occluded point is darkened (0-1)
+	EnvironmentIntensity            float64    // multiplier of light coming from environment map
 	DefaultBackgroundSolidColorRGBA [4]uint8
-	Triangulation                   int // number of triangles at the side of square
-	InterpolationPointsPerSide      int
+	Triangulation                   int     // number of triangles at the side of square
+	InterpolationPointsPerSide      int     // number of control points per patch side, patch degree is one less
+	PatchesPerSide                  int     // number of Bezier patches at the side of square
+	Continuity                      int     // continuity between neighbouring patches (0 for C0, 1 for C1)
+	SplineDegree                    int     // degree of B-spline and NURBS surfaces
+	HeightMapScale                  float64 // vertical scale of heightmap surface
+	JPEGQuality                     int     // quality of exported JPEG images (1-100)
+	ExportSupersampling             int     // pixel of image exported from window is average of n x n rendered pixels
+	Projection                      int     // camera projection (0 for orthographic, 1 for perspective)
+	FOV                             float64 // vertical field of view of perspective camera in degrees
+	Shading                         int     // shading model (0 for flat, 1 for Gouraud, 2 for Phong)
+	ToneMapping                     int     // tone mapping operator (0 for clamp, 1 for Reinhard, 2 for ACES filmic)
+	Exposure                        float64 // in stops, light is multiplied by 2^exposure before tone mapping
+	Gamma                           float64 // exponent of encoding of tone mapped light in image
+	BRDF                            string  // reflectance model (phong, blinn-phong, oren-nayar or cook-torrance)
 }
 
 type LightConfig struct {
@@ -0,0 +1,160 @@
+package draw
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sync/atomic"
+
+	"github.com/zeraye/bezier-shading/pkg/hdr"
+)
+
+// Depth buffer with colour of nearest fragment for every pixel, safe to use
+// from many goroutines at once. Depth (float32 bits, which compare like
+// unsigned integers for non-negative numbers) and colour are packed into one
+// uint64, so that both are swapped together with single compare-and-swap.
+type DepthBuffer struct {
+	width    int
+	height   int
+	pixels   []atomic.Uint64
+	radiance *hdr.Image // kept only if asked for with KeepRadiance
+}
+
+const emptyDepth = math.MaxUint32
+
+func packFragment(depth float32, c color.RGBA) uint64 {
+	return uint64(math.Float32bits(depth))<<32 |
+		uint64(c.R)<<24 | uint64(c.G)<<16 | uint64(c.B)<<8 | uint64(c.A)
+}
+
+func unpackFragment(fragment uint64) (uint32, color.RGBA) {
+	return uint32(fragment >> 32), color.RGBA{uint8(fragment >> 24), uint8(fragment >> 16), uint8(fragment >> 8), uint8(fragment)}
+}
+
+// Create width x height depth buffer with all pixels empty and set to
+// background color
+func NewDepthBuffer(width, height int, background color.Color) *DepthBuffer {
+	b := &DepthBuffer{width: width, height: height, pixels: make([]atomic.Uint64, width*height)}
+	empty := uint64(emptyDepth)<<32 | packFragment(0, color.RGBAModel.Convert(background).(color.RGBA))
+	for i := range b.pixels {
+		b.pixels[i].Store(empty)
+	}
+	return b
+}
+
+// Keep linear light of nearest fragments besides their colors, background
+// color is decoded from sRGB. Radiance isn't swapped together with depth, so
+// every pixel has to be set by one goroutine at a time.
+func (b *DepthBuffer) KeepRadiance(background color.Color) {
+	b.radiance = hdr.NewImage(b.width, b.height)
+	r, g, bl := ColorLinearRGB(background)
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			b.radiance.SetRGB(x, y, r, g, bl)
+		}
+	}
+}
+
+func (b *DepthBuffer) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.width, b.height)
+}
+
+// Set pixel (x, y) to color if depth (non-negative, smaller is nearer) is
+// smaller than depth already stored there. Returns whether pixel was set.
+// Kept radiance is set to color decoded from sRGB.
+func (b *DepthBuffer) Set(x, y int, depth float64, c color.Color) bool {
+	if !b.set(x, y, depth, color.RGBAModel.Convert(c).(color.RGBA)) {
+		return false
+	}
+	if b.radiance != nil {
+		r, g, bl := ColorLinearRGB(c)
+		b.radiance.SetRGB(x, y, r, g, bl)
+	}
+	return true
+}
+
+// Set pixel (x, y) like Set, with kept radiance set to linear light (r, g, b)
+// shown by color. Color is taken as it is, without converting it, because
+// this is called for every shaded pixel.
+func (b *DepthBuffer) SetRadiance(x, y int, depth float64, c color.RGBA, r, g, bl float64) bool {
+	if !b.set(x, y, depth, c) {
+		return false
+	}
+	if b.radiance != nil {
+		b.radiance.SetRGB(x, y, r, g, bl)
+	}
+	return true
+}
+
+func (b *DepthBuffer) set(x, y int, depth float64, c color.RGBA) bool {
+	if x < 0 || y < 0 || x >= b.width || y >= b.height || depth < 0 {
+		return false
+	}
+	fragment := packFragment(float32(depth), c)
+	pixel := &b.pixels[y*b.width+x]
+	for {
+		old := pixel.Load()
+		if fragment>>32 >= old>>32 {
+			return false
+		}
+		if pixel.CompareAndSwap(old, fragment) {
+			return true
+		}
+	}
+}
+
+// Depth of pixel (x, y), ok is false if nothing was drawn there
+func (b *DepthBuffer) Depth(x, y int) (depth float64, ok bool) {
+	bits, _ := unpackFragment(b.pixels[y*b.width+x].Load())
+	if bits == emptyDepth {
+		return 0, false
+	}
+	return float64(math.Float32frombits(bits)), true
+}
+
+// Linear light of nearest fragments, nil if it isn't kept
+func (b *DepthBuffer) Radiance() *hdr.Image {
+	return b.radiance
+}
+
+// Image with colors of nearest fragments
+func (b *DepthBuffer) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, b.width, b.height))
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			_, c := unpackFragment(b.pixels[y*b.width+x].Load())
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// Grayscale image of depth, nearest drawn pixel is white and farthest is
+// black, empty pixels keep background color
+func (b *DepthBuffer) DepthImage() *image.RGBA {
+	near, far := math.Inf(1), math.Inf(-1)
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			if depth, ok := b.Depth(x, y); ok {
+				near = math.Min(near, depth)
+				far = math.Max(far, depth)
+			}
+		}
+	}
+
+	img := b.Image()
+	for y := 0; y < b.height; y++ {
+		for x := 0; x < b.width; x++ {
+			depth, ok := b.Depth(x, y)
+			if !ok {
+				continue
+			}
+			gray := uint8(255)
+			if far > near {
+				gray = uint8(math.Round(255 * (far - depth) / (far - near)))
+			}
+			img.SetRGBA(x, y, color.RGBA{gray, gray, gray, 255})
+		}
+	}
+	return img
+}
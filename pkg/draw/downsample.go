@@ -0,0 +1,39 @@
+package draw
+
+import (
+	"image"
+	"image/color"
+)
+
+// Shrink image factor times in both directions, every pixel of result is
+// average of factor x factor block of pixels. Result has 16 bits per channel,
+// so that precision gained by averaging isn't lost.
+func Downsample(img *image.RGBA, factor int) *image.RGBA64 {
+	bounds := img.Bounds()
+	result := image.NewRGBA64(image.Rect(0, 0, bounds.Dx()/factor, bounds.Dy()/factor))
+	samples := uint32(factor * factor)
+
+	for y := 0; y < result.Bounds().Dy(); y++ {
+		for x := 0; x < result.Bounds().Dx(); x++ {
+			var r, g, b, a uint32
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					c := img.RGBAAt(bounds.Min.X+x*factor+dx, bounds.Min.Y+y*factor+dy)
+					r += uint32(c.R)
+					g += uint32(c.G)
+					b += uint32(c.B)
+					a += uint32(c.A)
+				}
+			}
+			// 8-bit values are scaled to 16 bits (x * 257) before division,
+			// so that rounding happens only once
+			result.SetRGBA64(x, y, color.RGBA64{
+				R: uint16((r*257 + samples/2) / samples),
+				G: uint16((g*257 + samples/2) / samples),
+				B: uint16((b*257 + samples/2) / samples),
+				A: uint16((a*257 + samples/2) / samples),
+			})
+		}
+	}
+	return result
+}
@@ -29,3 +29,9 @@ func ColorNormalRGBA(color color.Color) (r, g, b, a float64) {
 	a /= 255
 	return
 }
+
+// Inverse of RGBAToColor
+func ColorToRGBA(color color.Color) [4]uint8 {
+	r, g, b, a := ColorRGBA(color)
+	return [4]uint8{uint8(r), uint8(g), uint8(b), uint8(a)}
+}
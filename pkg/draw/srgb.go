@@ -0,0 +1,28 @@
+package draw
+
+import (
+	"image/color"
+	"math"
+)
+
+// Linear values of 8-bit sRGB channel values
+var srgbToLinear = func() (table [256]float64) {
+	for i := range table {
+		table[i] = SRGBToLinear(float64(i) / 255)
+	}
+	return
+}()
+
+// Decode sRGB encoded channel value (0-1) to linear light
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// Get (r, g, b) values from sRGB encoded Color in linear light, values are 0-1
+func ColorLinearRGB(color color.Color) (r, g, b float64) {
+	ir, ig, ib, _ := ColorRGBA(color)
+	return srgbToLinear[ir], srgbToLinear[ig], srgbToLinear[ib]
+}
@@ -1,9 +1,14 @@
 package geom
 
 type Triangle struct {
-	P0, P1, P2 *Point
+	P0, P1, P2    *Point
+	UV0, UV1, UV2 *Point // parametric coordinates of vertices, may be nil
 }
 
 func NewTriangle(p0, p1, p2 *Point) *Triangle {
-	return &Triangle{p0, p1, p2}
+	return &Triangle{P0: p0, P1: p1, P2: p2}
+}
+
+func NewTriangleUV(p0, p1, p2, uv0, uv1, uv2 *Point) *Triangle {
+	return &Triangle{p0, p1, p2, uv0, uv1, uv2}
 }
@@ -0,0 +1,136 @@
+package hdr
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Compression of OpenEXR scanlines
+type EXRCompression byte
+
+const (
+	EXRNone EXRCompression = 0
+	EXRZIP  EXRCompression = 3 // zlib compressed blocks of 16 scanlines
+)
+
+// Write image in OpenEXR format (.exr), as single part scanline image with
+// 32-bit float R, G and B channels
+func EncodeEXR(w io.Writer, img *Image, compression EXRCompression) error {
+	linesPerBlock := 1
+	switch compression {
+	case EXRNone:
+	case EXRZIP:
+		linesPerBlock = 16
+	default:
+		return fmt.Errorf("unsupported OpenEXR compression %d", compression)
+	}
+
+	var header bytes.Buffer
+	le := binary.LittleEndian
+	// magic number and version 2 without flags
+	header.Write([]byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0})
+	attribute := func(name, kind string, value []byte) {
+		header.WriteString(name + "\x00" + kind + "\x00")
+		header.Write(le.AppendUint32(nil, uint32(len(value))))
+		header.Write(value)
+	}
+	box := func(xMin, yMin, xMax, yMax int) []byte {
+		value := []byte{}
+		for _, v := range []int{xMin, yMin, xMax, yMax} {
+			value = le.AppendUint32(value, uint32(int32(v)))
+		}
+		return value
+	}
+	// channels are sorted by name, pixel type 2 is 32-bit float
+	channels := []byte{}
+	for _, name := range []string{"B", "G", "R"} {
+		channels = append(channels, name+"\x00"...)
+		channels = le.AppendUint32(channels, 2)
+		channels = append(channels, 0, 0, 0, 0)
+		channels = le.AppendUint32(channels, 1)
+		channels = le.AppendUint32(channels, 1)
+	}
+	channels = append(channels, 0)
+	attribute("channels", "chlist", channels)
+	attribute("compression", "compression", []byte{byte(compression)})
+	attribute("dataWindow", "box2i", box(0, 0, img.Width-1, img.Height-1))
+	attribute("displayWindow", "box2i", box(0, 0, img.Width-1, img.Height-1))
+	attribute("lineOrder", "lineOrder", []byte{0})
+	attribute("pixelAspectRatio", "float", le.AppendUint32(nil, math.Float32bits(1)))
+	attribute("screenWindowCenter", "v2f", make([]byte, 8))
+	attribute("screenWindowWidth", "float", le.AppendUint32(nil, math.Float32bits(1)))
+	header.WriteByte(0)
+
+	// blocks are prepared first, offset table before them points to every one
+	blocks := [][]byte{}
+	for y := 0; y < img.Height; y += linesPerBlock {
+		data := []byte{}
+		for line := y; line < min(y+linesPerBlock, img.Height); line++ {
+			for _, channel := range []int{2, 1, 0} {
+				for x := 0; x < img.Width; x++ {
+					data = le.AppendUint32(data, math.Float32bits(img.Pix[3*(line*img.Width+x)+channel]))
+				}
+			}
+		}
+		if compression == EXRZIP {
+			var err error
+			data, err = zipEXRBlock(data)
+			if err != nil {
+				return err
+			}
+		}
+		block := le.AppendUint32(nil, uint32(y))
+		block = le.AppendUint32(block, uint32(len(data)))
+		blocks = append(blocks, append(block, data...))
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(header.Bytes())
+	offset := uint64(header.Len() + 8*len(blocks))
+	for _, block := range blocks {
+		bw.Write(le.AppendUint64(nil, offset))
+		offset += uint64(len(block))
+	}
+	for _, block := range blocks {
+		bw.Write(block)
+	}
+	return bw.Flush()
+}
+
+// Compress block of OpenEXR scanlines with ZIP compression: bytes are split
+// into even and odd ones, replaced by differences and deflated. Block which
+// doesn't get smaller is stored uncompressed.
+func zipEXRBlock(data []byte) ([]byte, error) {
+	reordered := make([]byte, len(data))
+	half := (len(data) + 1) / 2
+	for i, b := range data {
+		if i%2 == 0 {
+			reordered[i/2] = b
+		} else {
+			reordered[half+i/2] = b
+		}
+	}
+	for i := len(reordered) - 1; i > 0; i-- {
+		reordered[i] = reordered[i] - reordered[i-1] + 128
+	}
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, err := zw.Write(reordered)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	if compressed.Len() >= len(data) {
+		return data, nil
+	}
+	return compressed.Bytes(), nil
+}
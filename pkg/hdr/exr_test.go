@@ -0,0 +1,192 @@
+package hdr
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+)
+
+// Header attribute of OpenEXR file
+type exrAttribute struct {
+	kind  string
+	value []byte
+}
+
+// Read null terminated string from start of data, returns rest of data
+func readString(t *testing.T, data []byte) (string, []byte) {
+	i := bytes.IndexByte(data, 0)
+	if i < 0 {
+		t.Fatal("string isn't null terminated")
+	}
+	return string(data[:i]), data[i+1:]
+}
+
+// Parse magic number, version and attributes of OpenEXR file, returns rest
+// of file following header
+func parseEXRHeader(t *testing.T, data []byte) (map[string]exrAttribute, []byte) {
+	if len(data) < 8 || !bytes.Equal(data[:8], []byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0}) {
+		t.Fatalf("file starts with % x, want magic number and version 2", data[:min(8, len(data))])
+	}
+	data = data[8:]
+	attributes := map[string]exrAttribute{}
+	for {
+		var name, kind string
+		name, data = readString(t, data)
+		if name == "" {
+			return attributes, data
+		}
+		kind, data = readString(t, data)
+		size := int(binary.LittleEndian.Uint32(data))
+		data = data[4:]
+		if size > len(data) {
+			t.Fatalf("attribute %s of size %d past end of file", name, size)
+		}
+		attributes[name] = exrAttribute{kind, data[:size]}
+		data = data[size:]
+	}
+}
+
+// Reverse ZIP compression of block: inflate, undo differences and interleave
+// even and odd bytes
+func unzipEXRBlock(t *testing.T, data []byte) []byte {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reordered, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < len(reordered); i++ {
+		reordered[i] = reordered[i-1] + reordered[i] - 128
+	}
+	raw := make([]byte, len(reordered))
+	half := (len(raw) + 1) / 2
+	for i := range raw {
+		if i%2 == 0 {
+			raw[i] = reordered[i/2]
+		} else {
+			raw[i] = reordered[half+i/2]
+		}
+	}
+	return raw
+}
+
+func TestEncodeEXR(t *testing.T) {
+	tests := []struct {
+		name          string
+		compression   EXRCompression
+		linesPerBlock int
+	}{
+		{"uncompressed", EXRNone, 1},
+		{"ZIP compressed", EXRZIP, 16},
+	}
+	const width, height = 7, 20
+	img := NewImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetRGB(x, y, float64(x)/width, float64(y)/height, 100*float64(x+y))
+		}
+	}
+	le := binary.LittleEndian
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := EncodeEXR(&buf, img, test.compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := buf.Bytes()
+			attributes, rest := parseEXRHeader(t, file)
+
+			// required attributes of scanline image
+			kinds := map[string]string{
+				"channels":           "chlist",
+				"compression":        "compression",
+				"dataWindow":         "box2i",
+				"displayWindow":      "box2i",
+				"lineOrder":          "lineOrder",
+				"pixelAspectRatio":   "float",
+				"screenWindowCenter": "v2f",
+				"screenWindowWidth":  "float",
+			}
+			for name, kind := range kinds {
+				if attributes[name].kind != kind {
+					t.Errorf("attribute %s has type %q, want %q", name, attributes[name].kind, kind)
+				}
+			}
+			channels := attributes["channels"].value
+			for _, want := range []string{"B", "G", "R"} {
+				var name string
+				name, channels = readString(t, channels)
+				if name != want || len(channels) < 16 || le.Uint32(channels) != 2 {
+					t.Fatalf("channel %q isn't 32-bit float channel %s", name, want)
+				}
+				channels = channels[16:]
+			}
+			if !bytes.Equal(channels, []byte{0}) {
+				t.Errorf("channel list doesn't end after B, G, R")
+			}
+			if compression := attributes["compression"].value; !bytes.Equal(compression, []byte{byte(test.compression)}) {
+				t.Errorf("compression attribute % x, want %d", compression, test.compression)
+			}
+			for _, name := range []string{"dataWindow", "displayWindow"} {
+				box := attributes[name].value
+				if len(box) != 16 || le.Uint32(box[8:]) != width-1 || le.Uint32(box[12:]) != height-1 {
+					t.Errorf("%s % x, want (0, 0)-(%d, %d)", name, box, width-1, height-1)
+				}
+			}
+
+			// offset table points to consecutive blocks ending at end of file
+			blocks := (height + test.linesPerBlock - 1) / test.linesPerBlock
+			headerSize := len(file) - len(rest)
+			offset := uint64(headerSize + 8*blocks)
+			lineSize := 3 * 4 * width
+			for i := 0; i < blocks; i++ {
+				if got := le.Uint64(rest[8*i:]); got != offset {
+					t.Fatalf("offset of block %d is %d, want %d", i, got, offset)
+				}
+				block := file[offset:]
+				y := int(int32(le.Uint32(block)))
+				size := int(le.Uint32(block[4:]))
+				if y != i*test.linesPerBlock {
+					t.Fatalf("block %d starts at line %d, want %d", i, y, i*test.linesPerBlock)
+				}
+				data := block[8 : 8+size]
+				lines := min(test.linesPerBlock, height-y)
+				if test.compression == EXRZIP && size < lines*lineSize {
+					data = unzipEXRBlock(t, data)
+				}
+				if len(data) != lines*lineSize {
+					t.Fatalf("block %d has %d bytes of pixels, want %d", i, len(data), lines*lineSize)
+				}
+				for line := 0; line < lines; line++ {
+					for c, channel := range []int{2, 1, 0} {
+						for x := 0; x < width; x++ {
+							got := math.Float32frombits(le.Uint32(data[line*lineSize+4*(c*width+x):]))
+							want := img.Pix[3*((y+line)*width+x)+channel]
+							if got != want {
+								t.Fatalf("channel %d of pixel (%d, %d) is %g, want %g", channel, x, y+line, got, want)
+							}
+						}
+					}
+				}
+				offset += uint64(8 + size)
+			}
+			if offset != uint64(len(file)) {
+				t.Errorf("blocks end at %d, file has %d bytes", offset, len(file))
+			}
+		})
+	}
+}
+
+func TestEncodeEXRUnsupportedCompression(t *testing.T) {
+	err := EncodeEXR(io.Discard, NewImage(1, 1), 4)
+	if err == nil {
+		t.Error("PIZ compression accepted")
+	}
+}
@@ -0,0 +1,45 @@
+package hdr
+
+// Image with floating point RGB values, which aren't limited to 0-1 range,
+// e.g. radiance of environment or of rendered scene
+type Image struct {
+	Width  int
+	Height int
+	Pix    []float32 // RGB values of pixels, row by row
+}
+
+func NewImage(width, height int) *Image {
+	return &Image{Width: width, Height: height, Pix: make([]float32, 3*width*height)}
+}
+
+func (img *Image) RGB(x, y int) (r, g, b float64) {
+	i := 3 * (y*img.Width + x)
+	return float64(img.Pix[i]), float64(img.Pix[i+1]), float64(img.Pix[i+2])
+}
+
+// Shrink image factor times in both directions, every pixel of result is
+// average of factor x factor block of pixels
+func Downsample(img *Image, factor int) *Image {
+	result := NewImage(img.Width/factor, img.Height/factor)
+	samples := float64(factor * factor)
+	for y := 0; y < result.Height; y++ {
+		for x := 0; x < result.Width; x++ {
+			var r, g, b float64
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					sr, sg, sb := img.RGB(x*factor+dx, y*factor+dy)
+					r += sr
+					g += sg
+					b += sb
+				}
+			}
+			result.SetRGB(x, y, r/samples, g/samples, b/samples)
+		}
+	}
+	return result
+}
+
+func (img *Image) SetRGB(x, y int, r, g, b float64) {
+	i := 3 * (y*img.Width + x)
+	img.Pix[i], img.Pix[i+1], img.Pix[i+2] = float32(r), float32(g), float32(b)
+}
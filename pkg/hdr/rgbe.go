@@ -0,0 +1,236 @@
+package hdr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Read image in Radiance RGBE format (.hdr), with flat or run-length encoded
+// scanlines. Only standard orientation (-Y height +X width) is supported.
+func Decode(r io.Reader) (*Image, error) {
+	br := bufio.NewReader(r)
+
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "#?") {
+		return nil, errors.New("not a Radiance HDR file")
+	}
+	// header ends with empty line
+	for {
+		line, err = br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("unsupported Radiance HDR format %q", strings.TrimPrefix(line, "FORMAT="))
+		}
+	}
+
+	line, err = br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	var width, height int
+	_, err = fmt.Sscanf(line, "-Y %d +X %d", &height, &width)
+	if err != nil || width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("unsupported Radiance HDR resolution %q", strings.TrimSpace(line))
+	}
+
+	img := NewImage(width, height)
+	scanline := make([]byte, 4*width)
+	for y := 0; y < height; y++ {
+		err = readScanline(br, scanline, width)
+		if err != nil {
+			return nil, err
+		}
+		for x := 0; x < width; x++ {
+			red, green, blue, exponent := scanline[4*x], scanline[4*x+1], scanline[4*x+2], scanline[4*x+3]
+			if exponent == 0 {
+				continue
+			}
+			f := math.Ldexp(1, int(exponent)-(128+8))
+			img.SetRGB(x, y, (float64(red)+0.5)*f, (float64(green)+0.5)*f, (float64(blue)+0.5)*f)
+		}
+	}
+	return img, nil
+}
+
+// Write image in Radiance RGBE format (.hdr) with run-length encoded
+// scanlines. Negative values are written as 0.
+func Encode(w io.Writer, img *Image) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n-Y %d +X %d\n", img.Height, img.Width)
+
+	scanline := make([]byte, 4*img.Width)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, b := img.RGB(x, y)
+			copy(scanline[4*x:4*x+4], rgbe(r, g, b))
+		}
+		err := writeScanline(bw, scanline, img.Width)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Shared exponent encoding of color, mantissas are scaled so that the largest
+// one is in 128-255
+func rgbe(r, g, b float64) []byte {
+	r, g, b = math.Max(r, 0), math.Max(g, 0), math.Max(b, 0)
+	m := math.Max(r, math.Max(g, b))
+	if !(m >= 1e-32) {
+		// too dark or NaN
+		return []byte{0, 0, 0, 0}
+	}
+	frac, exponent := math.Frexp(m)
+	if exponent > 127 || math.IsInf(m, 1) {
+		// brighter colors are clamped to the largest value
+		m = math.Ldexp(255.0/256, 127)
+		r, g, b = math.Min(r, m), math.Min(g, m), math.Min(b, m)
+		frac, exponent = 255.0/256, 127
+	}
+	scale := frac * 256 / m
+	return []byte{byte(r * scale), byte(g * scale), byte(b * scale), byte(exponent + 128)}
+}
+
+// Write RGBE bytes of scanline of width pixels, run-length encoded if width
+// allows it
+func writeScanline(bw *bufio.Writer, scanline []byte, width int) error {
+	if width < 8 || width > 0x7fff {
+		_, err := bw.Write(scanline)
+		return err
+	}
+	bw.Write([]byte{2, 2, byte(width >> 8), byte(width)})
+
+	value := func(channel, x int) byte {
+		return scanline[4*x+channel]
+	}
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+			// runs shorter than 4 bytes are cheaper as part of literal span
+			run := 1
+			for x+run < width && run < 127 && value(channel, x+run) == value(channel, x) {
+				run++
+			}
+			if run >= 4 {
+				bw.Write([]byte{byte(128 + run), value(channel, x)})
+				x += run
+				continue
+			}
+
+			// literal span ends where run of at least 4 bytes starts
+			end := x + 1
+			for end < width && end-x < 128 {
+				if end+3 < width && value(channel, end) == value(channel, end+1) && value(channel, end) == value(channel, end+2) && value(channel, end) == value(channel, end+3) {
+					break
+				}
+				end++
+			}
+			bw.WriteByte(byte(end - x))
+			for ; x < end; x++ {
+				bw.WriteByte(value(channel, x))
+			}
+		}
+	}
+	return nil
+}
+
+// Read scanline of width pixels into RGBE bytes of pixels
+func readScanline(br *bufio.Reader, scanline []byte, width int) error {
+	start, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+	// run-length encoded scanline starts with 2, 2 and its width, it is
+	// used only for widths from 8 to 32767
+	if width < 8 || width > 0x7fff || start[0] != 2 || start[1] != 2 || start[2]&0x80 != 0 {
+		return readFlatScanline(br, scanline, width)
+	}
+	if int(start[2])<<8|int(start[3]) != width {
+		return errors.New("invalid Radiance HDR scanline width")
+	}
+	br.Discard(4)
+
+	// channels are encoded one after another, as runs of repeated byte
+	// (count above 128) or of different bytes
+	for channel := 0; channel < 4; channel++ {
+		for x := 0; x < width; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				n := int(count) - 128
+				value, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				if x+n > width {
+					return errors.New("invalid Radiance HDR run length")
+				}
+				for ; n > 0; n-- {
+					scanline[4*x+channel] = value
+					x++
+				}
+			} else {
+				n := int(count)
+				if n == 0 || x+n > width {
+					return errors.New("invalid Radiance HDR run length")
+				}
+				for ; n > 0; n-- {
+					value, err := br.ReadByte()
+					if err != nil {
+						return err
+					}
+					scanline[4*x+channel] = value
+					x++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Read scanline stored as RGBE bytes, in which old run-length encoding
+// repeats previous pixel for pixels with red, green and blue equal to 1
+func readFlatScanline(br *bufio.Reader, scanline []byte, width int) error {
+	shift := 0
+	for x := 0; x < width; {
+		pixel := scanline[4*x : 4*x+4]
+		_, err := io.ReadFull(br, pixel)
+		if err != nil {
+			return err
+		}
+		if pixel[0] == 1 && pixel[1] == 1 && pixel[2] == 1 {
+			if x == 0 {
+				return errors.New("invalid Radiance HDR run length")
+			}
+			n := int(pixel[3]) << shift
+			if x+n > width {
+				return errors.New("invalid Radiance HDR run length")
+			}
+			previous := scanline[4*(x-1) : 4*x]
+			for ; n > 0; n-- {
+				copy(scanline[4*x:4*x+4], previous)
+				x++
+			}
+			shift += 8
+			continue
+		}
+		shift = 0
+		x++
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package hdr
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Image with random pixels spanning several orders of magnitude, rows from
+// runRow on have the same color in every pixel
+func testImage(width, height, runRow int) *Image {
+	rng := rand.New(rand.NewSource(int64(width)))
+	img := NewImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if y >= runRow {
+				img.SetRGB(x, y, 0.25, 3, 1000)
+				continue
+			}
+			scale := math.Pow(10, rng.Float64()*8-4)
+			img.SetRGB(x, y, rng.Float64()*scale, rng.Float64()*scale, rng.Float64()*scale)
+		}
+	}
+	return img
+}
+
+func TestEncodeDecode(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		runRow        int
+	}{
+		{"flat scanlines below 8 pixels", 5, 4, 4},
+		{"run-length encoded scanlines", 300, 4, 4},
+		{"runs longer than 127", 300, 4, 2},
+		{"largest run-length encoded width", 32767, 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img := testImage(test.width, test.height, test.runRow)
+			var buf bytes.Buffer
+			err := Encode(&buf, img)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// rows of the same color have to take much less than their pixels
+			flatSize := 4 * test.width * test.height
+			runSize := 4 * test.width * (test.height - test.runRow)
+			if runSize > 0 && buf.Len() > flatSize-runSize/2 {
+				t.Errorf("%d bytes encoded for %d bytes of pixels, runs aren't encoded", buf.Len(), flatSize)
+			}
+
+			decoded, err := Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Width != img.Width || decoded.Height != img.Height {
+				t.Fatalf("decoded size %dx%d, want %dx%d", decoded.Width, decoded.Height, img.Width, img.Height)
+			}
+			for y := 0; y < img.Height; y++ {
+				for x := 0; x < img.Width; x++ {
+					r, g, b := img.RGB(x, y)
+					dr, dg, db := decoded.RGB(x, y)
+					tolerance := math.Max(r, math.Max(g, b)) / 256
+					if math.Abs(r-dr) > tolerance || math.Abs(g-dg) > tolerance || math.Abs(b-db) > tolerance {
+						t.Fatalf("pixel (%d, %d) decoded as (%g, %g, %g), want (%g, %g, %g)", x, y, dr, dg, db, r, g, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeClamps(t *testing.T) {
+	img := NewImage(1, 3)
+	img.SetRGB(0, 0, -1, 0, 0)
+	img.SetRGB(0, 1, math.Inf(1), 1, 0)
+	img.SetRGB(0, 2, math.NaN(), 0, 0)
+	var buf bytes.Buffer
+	err := Encode(&buf, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 3; y++ {
+		r, g, b := decoded.RGB(0, y)
+		for _, v := range []float64{r, g, b} {
+			if v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+				t.Errorf("pixel %d decoded as (%g, %g, %g)", y, r, g, b)
+			}
+		}
+	}
+}
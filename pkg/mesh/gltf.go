@@ -0,0 +1,283 @@
+package mesh
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+)
+
+// Image embedded into glTF file
+type Texture struct {
+	MimeType string // image/png or image/jpeg
+	Data     []byte
+}
+
+// Punctual light, directional and spot lights shine along their direction
+type Light struct {
+	Type           string // point, directional or spot
+	Position       [3]float64
+	Direction      [3]float64 // normalized, not used by point light
+	Color          [3]float64
+	Intensity      float64 // in candela, in lux for directional light
+	InnerConeAngle float64 // in radians, only for spot light
+	OuterConeAngle float64
+}
+
+// Rotation quaternion turning -z axis, along which glTF lights shine, to
+// direction d
+func (l *Light) rotation() []float64 {
+	d := l.Direction
+	// axis is cross product of -z and d, w is 1 + their dot product
+	q := []float64{d[1], -d[0], 0, 1 - d[2]}
+	norm := math.Sqrt(q[0]*q[0] + q[1]*q[1] + q[3]*q[3])
+	if norm < 1e-9 {
+		// d is +z, any half turn perpendicular to it works
+		return []float64{1, 0, 0, 0}
+	}
+	for i := range q {
+		q[i] /= norm
+	}
+	return q
+}
+
+const (
+	glbMagic     = 0x46546C67 // "glTF"
+	glbVersion   = 2
+	glbChunkJSON = 0x4E4F534A // "JSON"
+	glbChunkBIN  = 0x004E4942 // "BIN"
+
+	gltfFloat        = 5126
+	gltfUnsignedInt  = 5125
+	gltfArrayBuffer  = 34962
+	gltfElementArray = 34963
+	gltfLinear       = 9729
+	gltfRepeat       = 10497
+)
+
+// glTF binary buffer being built together with its buffer views
+type glbBuffer struct {
+	data        bytes.Buffer
+	bufferViews []map[string]any
+}
+
+// Append data as new buffer view aligned to 4 bytes, target is omitted if 0
+func (b *glbBuffer) add(data []byte, target int) int {
+	for b.data.Len()%4 != 0 {
+		b.data.WriteByte(0)
+	}
+	view := map[string]any{
+		"buffer":     0,
+		"byteOffset": b.data.Len(),
+		"byteLength": len(data),
+	}
+	if target != 0 {
+		view["target"] = target
+	}
+	b.data.Write(data)
+	b.bufferViews = append(b.bufferViews, view)
+	return len(b.bufferViews) - 1
+}
+
+func float32Bytes(values []float64) []byte {
+	data := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(float32(value)))
+	}
+	return data
+}
+
+// Write mesh in binary glTF 2.0 format with all data embedded. Mesh is
+// expected to be z up and is rotated to y up of glTF. Material is mapped to
+// metallic-roughness model, diffuse and normal textures are omitted if nil.
+// Lights are in the same coordinates as mesh.
+func WriteGLB(w io.Writer, m *Mesh, material Material, diffuse, normal *Texture, lights []Light) error {
+	buffer := &glbBuffer{}
+
+	positions := []float64{}
+	normals := []float64{}
+	uvs := []float64{}
+	minPosition := []float64{math.Inf(1), math.Inf(1), math.Inf(1)}
+	maxPosition := []float64{math.Inf(-1), math.Inf(-1), math.Inf(-1)}
+	for _, v := range m.Vertices {
+		positions = append(positions, v.Position[:]...)
+		normals = append(normals, v.Normal[:]...)
+		// glTF texture coordinates start at top left corner
+		uvs = append(uvs, v.UV[0], 1-v.UV[1])
+		for i := range v.Position {
+			// bounds are compared with float32 positions by validators
+			p := float64(float32(v.Position[i]))
+			minPosition[i] = math.Min(minPosition[i], p)
+			maxPosition[i] = math.Max(maxPosition[i], p)
+		}
+	}
+	indices := make([]byte, 0, 12*len(m.Triangles))
+	for _, t := range m.Triangles {
+		for _, index := range t {
+			indices = binary.LittleEndian.AppendUint32(indices, uint32(index))
+		}
+	}
+
+	accessors := []map[string]any{
+		{
+			"bufferView":    buffer.add(float32Bytes(positions), gltfArrayBuffer),
+			"componentType": gltfFloat,
+			"count":         len(m.Vertices),
+			"type":          "VEC3",
+			"min":           minPosition,
+			"max":           maxPosition,
+		},
+		{
+			"bufferView":    buffer.add(float32Bytes(normals), gltfArrayBuffer),
+			"componentType": gltfFloat,
+			"count":         len(m.Vertices),
+			"type":          "VEC3",
+		},
+		{
+			"bufferView":    buffer.add(float32Bytes(uvs), gltfArrayBuffer),
+			"componentType": gltfFloat,
+			"count":         len(m.Vertices),
+			"type":          "VEC2",
+		},
+		{
+			"bufferView":    buffer.add(indices, gltfElementArray),
+			"componentType": gltfUnsignedInt,
+			"count":         3 * len(m.Triangles),
+			"type":          "SCALAR",
+		},
+	}
+
+	// Phong exponent converted to roughness, so that highlights have similar
+	// size (alpha = roughness^2 = sqrt(2 / (shininess + 2)))
+	roughness := math.Pow(2/(material.Shininess+2), 0.25)
+	pbr := map[string]any{
+		"baseColorFactor": []float64{material.Diffuse[0], material.Diffuse[1], material.Diffuse[2], 1},
+		"metallicFactor":  0,
+		"roughnessFactor": roughness,
+	}
+	gltfMaterial := map[string]any{
+		"name":                 material.Name,
+		"pbrMetallicRoughness": pbr,
+		"extensions": map[string]any{
+			"KHR_materials_specular": map[string]any{
+				"specularColorFactor": material.Specular[:],
+			},
+		},
+	}
+	extensionsUsed := []string{"KHR_materials_specular"}
+
+	images := []map[string]any{}
+	textures := []map[string]any{}
+	addTexture := func(texture *Texture) int {
+		images = append(images, map[string]any{
+			"bufferView": buffer.add(texture.Data, 0),
+			"mimeType":   texture.MimeType,
+		})
+		textures = append(textures, map[string]any{"sampler": 0, "source": len(images) - 1})
+		return len(textures) - 1
+	}
+	if diffuse != nil {
+		pbr["baseColorTexture"] = map[string]any{"index": addTexture(diffuse)}
+	}
+	if normal != nil {
+		gltfMaterial["normalTexture"] = map[string]any{"index": addTexture(normal)}
+	}
+
+	// root node rotates z up mesh by -90 degrees around x axis to y up
+	nodes := []map[string]any{
+		{"rotation": []float64{-math.Sqrt2 / 2, 0, 0, math.Sqrt2 / 2}, "children": []int{1}},
+		{"mesh": 0},
+	}
+	doc := map[string]any{
+		"asset":  map[string]any{"version": "2.0", "generator": "bezier-shading"},
+		"scene":  0,
+		"scenes": []map[string]any{{"nodes": []int{0}}},
+		"meshes": []map[string]any{{
+			"primitives": []map[string]any{{
+				"attributes": map[string]any{"POSITION": 0, "NORMAL": 1, "TEXCOORD_0": 2},
+				"indices":    3,
+				"material":   0,
+			}},
+		}},
+		"materials": []map[string]any{gltfMaterial},
+		"accessors": accessors,
+	}
+	if len(textures) > 0 {
+		doc["samplers"] = []map[string]any{{
+			"magFilter": gltfLinear,
+			"minFilter": gltfLinear,
+			"wrapS":     gltfRepeat,
+			"wrapT":     gltfRepeat,
+		}}
+		doc["images"] = images
+		doc["textures"] = textures
+	}
+	if len(lights) > 0 {
+		gltfLights := []map[string]any{}
+		for i, light := range lights {
+			node := map[string]any{
+				"translation": light.Position[:],
+				"extensions": map[string]any{
+					"KHR_lights_punctual": map[string]any{"light": i},
+				},
+			}
+			gltfLight := map[string]any{
+				"type":      light.Type,
+				"color":     light.Color[:],
+				"intensity": light.Intensity,
+			}
+			if light.Type != "point" {
+				node["rotation"] = light.rotation()
+			}
+			if light.Type == "spot" {
+				gltfLight["spot"] = map[string]any{
+					"innerConeAngle": light.InnerConeAngle,
+					"outerConeAngle": light.OuterConeAngle,
+				}
+			}
+			nodes[0]["children"] = append(nodes[0]["children"].([]int), len(nodes))
+			nodes = append(nodes, node)
+			gltfLights = append(gltfLights, gltfLight)
+		}
+		doc["extensions"] = map[string]any{
+			"KHR_lights_punctual": map[string]any{"lights": gltfLights},
+		}
+		extensionsUsed = append(extensionsUsed, "KHR_lights_punctual")
+	}
+	doc["nodes"] = nodes
+	doc["extensionsUsed"] = extensionsUsed
+	doc["bufferViews"] = buffer.bufferViews
+	for buffer.data.Len()%4 != 0 {
+		buffer.data.WriteByte(0)
+	}
+	doc["buffers"] = []map[string]any{{"byteLength": buffer.data.Len()}}
+
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	// JSON chunk is padded with spaces
+	for len(jsonData)%4 != 0 {
+		jsonData = append(jsonData, ' ')
+	}
+
+	header := []uint32{
+		glbMagic, glbVersion, uint32(12 + 8 + len(jsonData) + 8 + buffer.data.Len()),
+		uint32(len(jsonData)), glbChunkJSON,
+	}
+	err = binary.Write(w, binary.LittleEndian, header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(jsonData)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(w, binary.LittleEndian, []uint32{uint32(buffer.data.Len()), glbChunkBIN})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buffer.data.Bytes())
+	return err
+}
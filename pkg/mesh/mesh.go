@@ -0,0 +1,46 @@
+package mesh
+
+import "math"
+
+type Vertex struct {
+	Position [3]float64
+	Normal   [3]float64 // normalized
+	UV       [2]float64 // texture coordinates, (0, 0) is bottom left corner
+}
+
+// Indexed triangle mesh, triangles are counter-clockwise when looking at
+// their front side
+type Mesh struct {
+	Vertices  []Vertex
+	Triangles [][3]int // indices of vertices
+}
+
+// Surface material, close to Wavefront MTL (Phong) model
+type Material struct {
+	Name           string
+	Ambient        [3]float64 // ambient color, premultiplied by ka
+	Diffuse        [3]float64 // diffuse color, premultiplied by kd
+	Specular       [3]float64 // specular color, premultiplied by ks
+	Shininess      float64    // Phong exponent
+	DiffuseTexture string     // path of diffuse color image, empty if none
+	NormalTexture  string     // path of tangent space normal map, empty if none
+}
+
+// Normal of triangle computed from positions of its vertices
+func (m *Mesh) TriangleNormal(triangle [3]int) [3]float64 {
+	p0 := m.Vertices[triangle[0]].Position
+	p1 := m.Vertices[triangle[1]].Position
+	p2 := m.Vertices[triangle[2]].Position
+	a := [3]float64{p1[0] - p0[0], p1[1] - p0[1], p1[2] - p0[2]}
+	b := [3]float64{p2[0] - p0[0], p2[1] - p0[1], p2[2] - p0[2]}
+	n := [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+	length := math.Sqrt(n[0]*n[0] + n[1]*n[1] + n[2]*n[2])
+	if length == 0 {
+		return [3]float64{0, 0, 0}
+	}
+	return [3]float64{n[0] / length, n[1] / length, n[2] / length}
+}
@@ -0,0 +1,57 @@
+package mesh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Write mesh in Wavefront OBJ format, mtlFile is name of material library
+// file with material named materialName, both are omitted if mtlFile is empty
+func WriteOBJ(w io.Writer, m *Mesh, mtlFile, materialName string) error {
+	bw := bufio.NewWriter(w)
+	if mtlFile != "" {
+		fmt.Fprintf(bw, "mtllib %s\n", mtlFile)
+	}
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "v %g %g %g\n", v.Position[0], v.Position[1], v.Position[2])
+	}
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "vt %g %g\n", v.UV[0], v.UV[1])
+	}
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "vn %g %g %g\n", v.Normal[0], v.Normal[1], v.Normal[2])
+	}
+	if mtlFile != "" {
+		fmt.Fprintf(bw, "usemtl %s\n", materialName)
+	}
+	for _, t := range m.Triangles {
+		// indices in OBJ start from 1, vertex, texture coordinates and
+		// normal share index
+		fmt.Fprintf(bw, "f %d/%d/%d %d/%d/%d %d/%d/%d\n",
+			t[0]+1, t[0]+1, t[0]+1,
+			t[1]+1, t[1]+1, t[1]+1,
+			t[2]+1, t[2]+1, t[2]+1)
+	}
+	return bw.Flush()
+}
+
+// Write material in Wavefront MTL format, texture paths are written as they
+// are, so they should be relative to MTL file
+func WriteMTL(w io.Writer, material Material) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "newmtl %s\n", material.Name)
+	fmt.Fprintf(bw, "Ka %g %g %g\n", material.Ambient[0], material.Ambient[1], material.Ambient[2])
+	fmt.Fprintf(bw, "Kd %g %g %g\n", material.Diffuse[0], material.Diffuse[1], material.Diffuse[2])
+	fmt.Fprintf(bw, "Ks %g %g %g\n", material.Specular[0], material.Specular[1], material.Specular[2])
+	fmt.Fprintf(bw, "Ns %g\n", material.Shininess)
+	// Phong illumination model with specular highlights
+	fmt.Fprintf(bw, "illum 2\n")
+	if material.DiffuseTexture != "" {
+		fmt.Fprintf(bw, "map_Kd %s\n", material.DiffuseTexture)
+	}
+	if material.NormalTexture != "" {
+		fmt.Fprintf(bw, "map_Bump %s\n", material.NormalTexture)
+	}
+	return bw.Flush()
+}
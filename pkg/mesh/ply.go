@@ -0,0 +1,31 @@
+package mesh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Write mesh in ASCII PLY format with vertex normals and texture coordinates
+func WritePLY(w io.Writer, m *Mesh) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "ply\n")
+	fmt.Fprintf(bw, "format ascii 1.0\n")
+	fmt.Fprintf(bw, "element vertex %d\n", len(m.Vertices))
+	for _, property := range []string{"x", "y", "z", "nx", "ny", "nz", "s", "t"} {
+		fmt.Fprintf(bw, "property float %s\n", property)
+	}
+	fmt.Fprintf(bw, "element face %d\n", len(m.Triangles))
+	fmt.Fprintf(bw, "property list uchar int vertex_indices\n")
+	fmt.Fprintf(bw, "end_header\n")
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "%g %g %g %g %g %g %g %g\n",
+			v.Position[0], v.Position[1], v.Position[2],
+			v.Normal[0], v.Normal[1], v.Normal[2],
+			v.UV[0], v.UV[1])
+	}
+	for _, t := range m.Triangles {
+		fmt.Fprintf(bw, "3 %d %d %d\n", t[0], t[1], t[2])
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,57 @@
+package mesh
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Write mesh in ASCII STL format. STL stores only positions and facet
+// normals, vertex normals and texture coordinates are lost.
+func WriteSTL(w io.Writer, m *Mesh, name string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "solid %s\n", name)
+	for _, t := range m.Triangles {
+		n := m.TriangleNormal(t)
+		fmt.Fprintf(bw, "  facet normal %g %g %g\n", n[0], n[1], n[2])
+		fmt.Fprintf(bw, "    outer loop\n")
+		for _, index := range t {
+			p := m.Vertices[index].Position
+			fmt.Fprintf(bw, "      vertex %g %g %g\n", p[0], p[1], p[2])
+		}
+		fmt.Fprintf(bw, "    endloop\n")
+		fmt.Fprintf(bw, "  endfacet\n")
+	}
+	fmt.Fprintf(bw, "endsolid %s\n", name)
+	return bw.Flush()
+}
+
+// Write mesh in binary STL format, see WriteSTL
+func WriteSTLBinary(w io.Writer, m *Mesh, name string) error {
+	bw := bufio.NewWriter(w)
+
+	// header mustn't start with "solid", otherwise it is taken for ASCII STL
+	header := make([]byte, 80)
+	copy(header, "binary STL "+name)
+	bw.Write(header)
+	binary.Write(bw, binary.LittleEndian, uint32(len(m.Triangles)))
+
+	facet := make([]byte, 50)
+	for _, t := range m.Triangles {
+		n := m.TriangleNormal(t)
+		values := []float64{n[0], n[1], n[2]}
+		for _, index := range t {
+			p := m.Vertices[index].Position
+			values = append(values, p[0], p[1], p[2])
+		}
+		for i, value := range values {
+			binary.LittleEndian.PutUint32(facet[i*4:], math.Float32bits(float32(value)))
+		}
+		// attribute byte count, unused
+		binary.LittleEndian.PutUint16(facet[48:], 0)
+		bw.Write(facet)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,81 @@
+package noise
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Gradient directions of lattice points
+var gradients = [8][2]float64{
+	{1, 0}, {-1, 0}, {0, 1}, {0, -1},
+	{math.Sqrt2 / 2, math.Sqrt2 / 2}, {-math.Sqrt2 / 2, math.Sqrt2 / 2},
+	{math.Sqrt2 / 2, -math.Sqrt2 / 2}, {-math.Sqrt2 / 2, -math.Sqrt2 / 2},
+}
+
+// Perlin gradient noise: https://en.wikipedia.org/wiki/Perlin_noise
+type Perlin struct {
+	perm [512]int
+}
+
+func NewPerlin(seed int64) *Perlin {
+	p := &Perlin{}
+	for i, v := range rand.New(rand.NewSource(seed)).Perm(256) {
+		p.perm[i] = v
+		p.perm[i+256] = v
+	}
+	return p
+}
+
+// Quintic fade curve and its derivative
+func fade(t float64) (float64, float64) {
+	return t * t * t * (t*(t*6-15) + 10), 30 * t * t * (t*(t-2) + 1)
+}
+
+func (p *Perlin) gradient(x, y int) (float64, float64) {
+	g := gradients[p.perm[p.perm[x&255]+(y&255)]&7]
+	return g[0], g[1]
+}
+
+// Noise value (about -1 to 1) at (x, y) with its partial derivatives
+func (p *Perlin) Noise2(x, y float64) (value, dx, dy float64) {
+	x0 := math.Floor(x)
+	y0 := math.Floor(y)
+	ix := int(x0)
+	iy := int(y0)
+	fx := x - x0
+	fy := y - y0
+
+	g00x, g00y := p.gradient(ix, iy)
+	g10x, g10y := p.gradient(ix+1, iy)
+	g01x, g01y := p.gradient(ix, iy+1)
+	g11x, g11y := p.gradient(ix+1, iy+1)
+
+	a := g00x*fx + g00y*fy
+	b := g10x*(fx-1) + g10y*fy
+	c := g01x*fx + g01y*(fy-1)
+	d := g11x*(fx-1) + g11y*(fy-1)
+
+	u, du := fade(fx)
+	v, dv := fade(fy)
+
+	value = a + u*(b-a) + v*(c-a) + u*v*(a-b-c+d)
+	dx = g00x + u*(g10x-g00x) + v*(g01x-g00x) + u*v*(g00x-g10x-g01x+g11x) + du*(b-a+v*(a-b-c+d))
+	dy = g00y + u*(g10y-g00y) + v*(g01y-g00y) + u*v*(g00y-g10y-g01y+g11y) + dv*(c-a+u*(a-b-c+d))
+	return
+}
+
+// Fractal Brownian motion: sum of octaves of noise, each with doubled
+// frequency and amplitude multiplied by persistence
+func (p *Perlin) Fractal2(x, y float64, octaves int, persistence float64) (value, dx, dy float64) {
+	amplitude := 1.0
+	frequency := 1.0
+	for o := 0; o < octaves; o++ {
+		n, ndx, ndy := p.Noise2(x*frequency, y*frequency)
+		value += amplitude * n
+		dx += amplitude * frequency * ndx
+		dy += amplitude * frequency * ndy
+		amplitude *= persistence
+		frequency *= 2
+	}
+	return
+}
@@ -0,0 +1,249 @@
+package scenefile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Version of scene files written by Save, files with older version are
+// upgraded when loaded
+const Version = 10
+
+// Functions upgrading scene from version (index + 1) to the next one
+var upgrades = []func(scene *Scene){
+	// 1 -> 2: camera with projection, field of view, zoom and pan
+	func(scene *Scene) {
+		scene.View.FOV = 45
+		scene.View.Zoom = 1
+	},
+	// 2 -> 3: shading model, older versions always used Phong shading
+	func(scene *Scene) {
+		scene.View.Shading = 2
+	},
+	// 3 -> 4: reflectance models, older versions always used Phong model
+	func(scene *Scene) {
+		scene.Material.BRDF = "phong"
+	},
+	// 4 -> 5: list of lights of different types replaces single point light
+	func(scene *Scene) {
+		light := scene.Light
+		scene.LightAnimation = light.Animation
+		light.Animation = false
+		light.Intensity = 1
+		light.Enabled = true
+		light.ConeAngle = 30
+		light.Falloff = 0.2
+		scene.Lights = []LightScene{light}
+		scene.Light = LightScene{}
+	},
+	// 5 -> 6: ambient light and attenuation, older versions had neither
+	func(scene *Scene) {
+		scene.Material.Ka = 0
+		scene.Material.AmbientColorRGBA = [4]uint8{255, 255, 255, 255}
+		for i := range scene.Lights {
+			scene.Lights[i].Attenuation = [3]float64{1, 0, 0}
+		}
+	},
+	// 6 -> 7: shadows, older versions didn't cast them
+	func(scene *Scene) {
+		scene.Shadows = ShadowsScene{Enabled: false, Bias: 2, LightRadius: 0, Samples: 16}
+	},
+	// 7 -> 8: ambient occlusion, older versions didn't darken surface with it
+	func(scene *Scene) {
+		scene.AmbientOcclusion = AmbientOcclusionScene{Enabled: false, Radius: 40, Samples: 16, Strength: 0.8}
+	},
+	// 8 -> 9: environment lighting
+	func(scene *Scene) {
+		scene.Environment = EnvironmentScene{Intensity: 1}
+	},
+	// 9 -> 10: tone mapping, older versions clamped light
+	func(scene *Scene) {
+		scene.View.ToneMapping = 0
+		scene.View.Exposure = 0
+		scene.View.Gamma = 2.2
+	},
+}
+
+type Scene struct {
+	Version        int
+	LightAnimation bool
+	// single light of version 4 and older, moved to Lights when upgraded
+	Light            LightScene `toml:",omitempty"`
+	Lights           []LightScene
+	Shadows          ShadowsScene
+	AmbientOcclusion AmbientOcclusionScene
+	Environment      EnvironmentScene
+	Material         MaterialScene
+	Background       BackgroundScene
+	Surface          SurfaceScene
+	View             ViewScene
+}
+
+type LightScene struct {
+	Type      int // 0 for point, 1 for directional, 2 for spot light
+	ColorRGBA [4]uint8
+	X         float64
+	Y         float64
+	Height    float64
+	Intensity float64
+	Enabled   bool
+	ConeAngle float64 // angle between spot light axis and edge of its cone in degrees
+	Falloff   float64 // part of spot light cone (0-1) where light fades out
+	// constant, linear and quadratic coefficients of attenuation with
+	// distance in units of surface height
+	Attenuation [3]float64
+	Animation   bool `toml:",omitempty"` // version 4 and older
+}
+
+type ShadowsScene struct {
+	Enabled     bool
+	Bias        float64 // height by which surface has to be above shadow ray to block it
+	LightRadius float64 // radius of lights casting soft shadows, 0 for hard shadows
+	Samples     int     // number of points of light sampled for soft shadows
+}
+
+type AmbientOcclusionScene struct {
+	Enabled  bool
+	Radius   float64 // distance from point within which surface is sampled
+	Samples  int
+	Strength float64 // how much fully occluded point is darkened (0-1)
+}
+
+type EnvironmentScene struct {
+	ImagePath string // equirectangular image relative to scene file, empty if none
+	Intensity float64
+	Rotation  float64 // around vertical axis in degrees
+}
+
+type MaterialScene struct {
+	Kd               float64
+	Ks               float64
+	M                float64
+	Ka               float64
+	AmbientColorRGBA [4]uint8
+	NormalMapPath    string // relative to scene file, empty if none
+	BRDF             string // reflectance model
+	// parameters of reflectance models, by model and parameter name
+	Params map[string]map[string]float64
+}
+
+type BackgroundScene struct {
+	IsSolidColor   bool
+	SolidColorRGBA [4]uint8
+	ImagePath      string // relative to scene file, empty if none
+}
+
+type SurfaceScene struct {
+	Type         string
+	PatchDegree  int
+	Continuity   int
+	SplineDegree int
+	KnotsU       []float64
+	KnotsV       []float64
+	Points       [][][2]float64 // raster positions of control points
+	PointsHeight [][]float64
+	PointsWeight [][]float64
+	// parameters of surfaces, by surface type and parameter name
+	Params map[string]map[string]float64
+	// files surfaces are loaded from, by surface type, relative to scene file
+	Files map[string]string
+}
+
+type ViewScene struct {
+	Triangulation int
+	ShowMesh      bool
+	Alpha         float64 // camera rotation around vertical axis
+	Beta          float64 // camera tilt from top-down view
+	Projection    int     // 0 for orthographic, 1 for perspective
+	FOV           float64 // vertical field of view in degrees
+	Zoom          float64
+	Pan           [3]float64 // camera target offset from raster centre
+	Shading       int        // 0 for flat, 1 for Gouraud, 2 for Phong
+	ToneMapping   int        // 0 for clamp, 1 for Reinhard, 2 for ACES filmic
+	Exposure      float64    // in stops
+	Gamma         float64
+}
+
+func Load(r io.Reader) (*Scene, error) {
+	var data Scene
+	_, err := toml.NewDecoder(r).Decode(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Version < 1 {
+		return nil, fmt.Errorf("invalid scene file version %d", data.Version)
+	}
+	if data.Version > Version {
+		return nil, fmt.Errorf("scene file version %d is newer than supported version %d", data.Version, Version)
+	}
+	for data.Version < Version {
+		upgrades[data.Version-1](&data)
+		data.Version++
+	}
+
+	return &data, nil
+}
+
+func LoadFile(path string) (*Scene, error) {
+	r, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+	return Load(r)
+}
+
+func (s *Scene) Save(w io.Writer) error {
+	s.Version = Version
+	return toml.NewEncoder(w).Encode(s)
+}
+
+func (s *Scene) SaveFile(path string) error {
+	w, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = s.Save(w)
+	if err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// Path of file referenced by scene file, relative paths are resolved against
+// directory of scene file
+func ResolvePath(scenePath, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(scenePath), filepath.FromSlash(path))
+}
+
+// Path of file to be stored in scene file, relative to directory of scene
+// file if possible
+func RelativePath(scenePath, path string) string {
+	if path == "" {
+		return path
+	}
+	absScenePath, err := filepath.Abs(scenePath)
+	if err != nil {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(filepath.Dir(absScenePath), absPath)
+	if err != nil {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+	"github.com/zeraye/bezier-shading/pkg/draw"
+	"github.com/zeraye/bezier-shading/pkg/geom"
+	"github.com/zeraye/bezier-shading/pkg/scenefile"
+)
+
+// State of scene needed to render it, shared by game widget and headless
+// renderer
+type Scene struct {
+	LightAnimation bool // light selected in menu moves around raster centre
+
+	config *config.Config
+
+	kd                     float64
+	ks                     float64
+	m                      float64
+	ka                     float64
+	ambientColor           color.Color
+	lights                 []*Light
+	shadows                bool
+	shadowBias             float64 // height by which surface has to be above shadow ray to block it
+	shadowLightRadius      float64 // lights are sampled on disk with this radius for soft shadows
+	shadowSamples          int
+	ao                     bool    // ambient occlusion
+	aoRadius               float64 // distance from point within which surface is sampled for ambient occlusion
+	aoSamples              int
+	aoStrength             float64 // how much fully occluded point is darkened
+	environment            *environment
+	environmentPath        string
+	environmentIntensity   float64
+	environmentRotation    float64 // rotation of environment around vertical axis in degrees
+	backgroundSolidColor   color.Color
+	backgroundImage        image.Image
+	backgroundImagePath    string
+	normalMap              image.Image
+	normalMapPath          string
+	isBackgroundSolidColor bool
+	points                 [][]*geom.Point
+	pointsHeight           [][]float64
+	patchDegree            int
+	continuity             int
+	pointsWeight           [][]float64
+	splineDegree           int
+	knotsU                 []float64
+	knotsV                 []float64
+	triangulation          int
+	triangles              []*geom.Triangle
+	showMesh               bool
+	surface                string
+	surfaces               map[string]Surface
+	alpha                  float64 // camera rotation around vertical axis
+	beta                   float64 // camera tilt from top-down view
+	projection             int
+	fov                    float64 // vertical field of view of perspective camera in degrees
+	zoom                   float64
+	pan                    Vec // camera target offset from raster centre
+	debugView              int
+	shading                int
+	toneMapping            int
+	exposure               float64 // in stops, light is multiplied by 2^exposure
+	gamma                  float64
+	brdf                   string
+	brdfs                  map[string]BRDF
+}
+
+func NewScene(config *config.Config) *Scene {
+	lightAnimation := config.Defaults.LightAnimation
+	triangulation := config.Defaults.Triangulation
+	backgroundSolidColor := draw.RGBAToColor(config.Defaults.DefaultBackgroundSolidColorRGBA)
+
+	patchDegree := config.Defaults.InterpolationPointsPerSide - 1
+	size := patchesGridSize(config.Defaults.PatchesPerSide, patchDegree)
+	points := make([][]*geom.Point, size)
+	for i := 0; i < size; i++ {
+		points[i] = make([]*geom.Point, size)
+	}
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			points[i][j] = geom.NewPoint(float64(config.UI.RasterWidth*i)/float64(size-1), float64(config.UI.RasterHeight*j)/float64(size-1))
+		}
+	}
+	triangles := makeTriangles(points, patchDegree, triangulation)
+
+	pointsHeight := make([][]float64, size)
+	for i := 0; i < size; i++ {
+		pointsHeight[i] = make([]float64, size)
+	}
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			pointsHeight[i][j] = 0
+		}
+	}
+
+	pointsWeight := make([][]float64, size)
+	for i := 0; i < size; i++ {
+		pointsWeight[i] = make([]float64, size)
+	}
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			pointsWeight[i][j] = 1
+		}
+	}
+	splineDegree := min(config.Defaults.SplineDegree, size-1)
+	knotsU := clampedKnots(size, splineDegree)
+	knotsV := clampedKnots(size, splineDegree)
+
+	var backgroundImage image.Image = nil
+	var normalMap image.Image = nil
+
+	scene := &Scene{
+		config:                 config,
+		kd:                     config.Defaults.Kd,
+		ks:                     config.Defaults.Ks,
+		m:                      config.Defaults.M,
+		ka:                     config.Defaults.Ka,
+		ambientColor:           draw.RGBAToColor(config.Defaults.AmbientColorRGBA),
+		LightAnimation:         lightAnimation,
+		lights:                 []*Light{newDefaultLight(config)},
+		shadows:                config.Defaults.Shadows,
+		shadowBias:             config.Defaults.ShadowBias,
+		shadowLightRadius:      config.Defaults.ShadowLightRadius,
+		shadowSamples:          config.Defaults.ShadowSamples,
+		ao:                     config.Defaults.AmbientOcclusion,
+		aoRadius:               config.Defaults.AORadius,
+		aoSamples:              config.Defaults.AOSamples,
+		aoStrength:             config.Defaults.AOStrength,
+		environmentIntensity:   config.Defaults.EnvironmentIntensity,
+		backgroundSolidColor:   backgroundSolidColor,
+		backgroundImage:        backgroundImage,
+		normalMap:              normalMap,
+		isBackgroundSolidColor: true,
+		points:                 points,
+		pointsHeight:           pointsHeight,
+		patchDegree:            patchDegree,
+		continuity:             config.Defaults.Continuity,
+		pointsWeight:           pointsWeight,
+		splineDegree:           splineDegree,
+		knotsU:                 knotsU,
+		knotsV:                 knotsV,
+		triangulation:          triangulation,
+		triangles:              triangles,
+		showMesh:               false,
+		surface:                "bezier",
+		surfaces:               newSurfaces(config),
+		alpha:                  0,
+		beta:                   0,
+		projection:             config.Defaults.Projection,
+		fov:                    config.Defaults.FOV,
+		zoom:                   1,
+		shading:                config.Defaults.Shading,
+		toneMapping:            config.Defaults.ToneMapping,
+		exposure:               config.Defaults.Exposure,
+		gamma:                  config.Defaults.Gamma,
+		brdf:                   config.Defaults.BRDF,
+	}
+	scene.brdfs = newBRDFs(scene)
+	return scene
+}
+
+// Scene file describing current state of scene, paths of files are stored
+// relative to scene file saved at path
+func (s *Scene) sceneFile(path string) *scenefile.Scene {
+	points := make([][][2]float64, len(s.points))
+	for i := range s.points {
+		points[i] = make([][2]float64, len(s.points[i]))
+		for j, point := range s.points[i] {
+			points[i][j] = [2]float64{point.X, point.Y}
+		}
+	}
+
+	params := map[string]map[string]float64{}
+	files := map[string]string{}
+	brdfParams := map[string]map[string]float64{}
+	for name, brdf := range s.brdfs {
+		if configurable, ok := brdf.(Configurable); ok {
+			brdfParams[name] = map[string]float64{}
+			for _, param := range configurable.Params() {
+				brdfParams[name][param.Name] = *param.Value
+			}
+		}
+	}
+	for name, surface := range s.surfaces {
+		if configurable, ok := surface.(Configurable); ok {
+			params[name] = map[string]float64{}
+			for _, param := range configurable.Params() {
+				params[name][param.Name] = *param.Value
+			}
+		}
+		if fileSurface, ok := surface.(FileSurface); ok && fileSurface.FilePath() != "" {
+			files[name] = scenefile.RelativePath(path, fileSurface.FilePath())
+		}
+	}
+
+	lights := make([]scenefile.LightScene, len(s.lights))
+	for i, light := range s.lights {
+		lights[i] = scenefile.LightScene{
+			Type:        light.kind,
+			ColorRGBA:   draw.ColorToRGBA(light.color),
+			X:           light.x,
+			Y:           light.y,
+			Height:      light.height,
+			Intensity:   light.intensity,
+			Enabled:     light.enabled,
+			ConeAngle:   light.coneAngle,
+			Falloff:     light.falloff,
+			Attenuation: light.attenuation,
+		}
+	}
+
+	return &scenefile.Scene{
+		LightAnimation: s.LightAnimation,
+		Lights:         lights,
+		Shadows: scenefile.ShadowsScene{
+			Enabled:     s.shadows,
+			Bias:        s.shadowBias,
+			LightRadius: s.shadowLightRadius,
+			Samples:     s.shadowSamples,
+		},
+		AmbientOcclusion: scenefile.AmbientOcclusionScene{
+			Enabled:  s.ao,
+			Radius:   s.aoRadius,
+			Samples:  s.aoSamples,
+			Strength: s.aoStrength,
+		},
+		Environment: scenefile.EnvironmentScene{
+			ImagePath: scenefile.RelativePath(path, s.environmentPath),
+			Intensity: s.environmentIntensity,
+			Rotation:  s.environmentRotation,
+		},
+		Material: scenefile.MaterialScene{
+			Kd:               s.kd,
+			Ks:               s.ks,
+			M:                s.m,
+			Ka:               s.ka,
+			AmbientColorRGBA: draw.ColorToRGBA(s.ambientColor),
+			NormalMapPath:    scenefile.RelativePath(path, s.normalMapPath),
+			BRDF:             s.brdf,
+			Params:           brdfParams,
+		},
+		Background: scenefile.BackgroundScene{
+			IsSolidColor:   s.isBackgroundSolidColor,
+			SolidColorRGBA: draw.ColorToRGBA(s.backgroundSolidColor),
+			ImagePath:      scenefile.RelativePath(path, s.backgroundImagePath),
+		},
+		Surface: scenefile.SurfaceScene{
+			Type:         s.surface,
+			PatchDegree:  s.patchDegree,
+			Continuity:   s.continuity,
+			SplineDegree: s.splineDegree,
+			KnotsU:       s.knotsU,
+			KnotsV:       s.knotsV,
+			Points:       points,
+			PointsHeight: s.pointsHeight,
+			PointsWeight: s.pointsWeight,
+			Params:       params,
+			Files:        files,
+		},
+		View: scenefile.ViewScene{
+			Triangulation: s.triangulation,
+			ShowMesh:      s.showMesh,
+			Alpha:         s.alpha,
+			Beta:          s.beta,
+			Projection:    s.projection,
+			FOV:           s.fov,
+			Zoom:          s.zoom,
+			Pan:           [3]float64{s.pan.x, s.pan.y, s.pan.z},
+			Shading:       s.shading,
+			ToneMapping:   s.toneMapping,
+			Exposure:      s.exposure,
+			Gamma:         s.gamma,
+		},
+	}
+}
+
+// Set scene to one loaded from file at path. File is validated and
+// referenced files are loaded first, so scene is left unchanged on error.
+func (s *Scene) loadSceneFile(file *scenefile.Scene, path string) error {
+	surface := file.Surface
+	if _, ok := s.surfaces[surface.Type]; !ok {
+		return fmt.Errorf("unknown surface type %q", surface.Type)
+	}
+	if surface.PatchDegree < 1 {
+		return fmt.Errorf("invalid patch degree %d", surface.PatchDegree)
+	}
+	if surface.Continuity != continuityC0 && surface.Continuity != continuityC1 {
+		return fmt.Errorf("invalid continuity %d", surface.Continuity)
+	}
+	size := len(surface.Points)
+	if size < 2 || (size-1)%surface.PatchDegree != 0 {
+		return fmt.Errorf("control points grid size %d doesn't match patch degree %d", size, surface.PatchDegree)
+	}
+	if len(surface.PointsHeight) != size || len(surface.PointsWeight) != size {
+		return fmt.Errorf("control points grids have different sizes")
+	}
+	for i := 0; i < size; i++ {
+		if len(surface.Points[i]) != size || len(surface.PointsHeight[i]) != size || len(surface.PointsWeight[i]) != size {
+			return fmt.Errorf("control points grids aren't square")
+		}
+	}
+	if surface.SplineDegree < 1 || surface.SplineDegree > size-1 {
+		return fmt.Errorf("invalid spline degree %d", surface.SplineDegree)
+	}
+	if err := validateKnots(surface.KnotsU, size, surface.SplineDegree); err != nil {
+		return err
+	}
+	if err := validateKnots(surface.KnotsV, size, surface.SplineDegree); err != nil {
+		return err
+	}
+	if file.View.Triangulation < triangulationMin || file.View.Triangulation > triangulationMax {
+		return fmt.Errorf("invalid triangulation %d", file.View.Triangulation)
+	}
+	if file.View.Projection != projectionOrthographic && file.View.Projection != projectionPerspective {
+		return fmt.Errorf("invalid projection %d", file.View.Projection)
+	}
+	if file.View.FOV <= 0 || file.View.FOV >= 180 {
+		return fmt.Errorf("invalid field of view %g", file.View.FOV)
+	}
+	if file.View.Zoom < zoomMin || file.View.Zoom > zoomMax {
+		return fmt.Errorf("invalid zoom %g", file.View.Zoom)
+	}
+	if file.View.Shading < shadingFlat || file.View.Shading > shadingPhong {
+		return fmt.Errorf("invalid shading %d", file.View.Shading)
+	}
+	if file.View.ToneMapping < toneMappingClamp || file.View.ToneMapping > toneMappingACES {
+		return fmt.Errorf("invalid tone mapping %d", file.View.ToneMapping)
+	}
+	if file.View.Gamma <= 0 {
+		return fmt.Errorf("invalid gamma %g", file.View.Gamma)
+	}
+	if _, ok := s.brdfs[file.Material.BRDF]; !ok {
+		return fmt.Errorf("unknown reflectance model %q", file.Material.BRDF)
+	}
+	material := file.Material
+	if !inRange(material.Kd, 0, 1) || !inRange(material.Ks, 0, 1) || !inRange(material.Ka, 0, 1) || !inRange(material.M, 1, 100) {
+		return fmt.Errorf("invalid material coefficients")
+	}
+	if len(file.Lights) == 0 {
+		return fmt.Errorf("scene has no lights")
+	}
+	if file.Shadows.Bias < 0 || file.Shadows.LightRadius < 0 || file.Shadows.Samples < 1 {
+		return fmt.Errorf("invalid shadow settings")
+	}
+	ao := file.AmbientOcclusion
+	if ao.Radius < 0 || ao.Samples < 1 || ao.Strength < 0 || ao.Strength > 1 {
+		return fmt.Errorf("invalid ambient occlusion settings")
+	}
+	err := checkParams(s.surfaces, surface.Params)
+	if err != nil {
+		return err
+	}
+	err = checkParams(s.brdfs, file.Material.Params)
+	if err != nil {
+		return err
+	}
+	if file.Environment.Intensity < 0 {
+		return fmt.Errorf("invalid environment intensity %g", file.Environment.Intensity)
+	}
+	lights := make([]*Light, len(file.Lights))
+	for i, light := range file.Lights {
+		if light.Type < lightTypePoint || light.Type > lightTypeSpot {
+			return fmt.Errorf("invalid type %d of light %d", light.Type, i+1)
+		}
+		if !inRange(light.Intensity, 0, 5) {
+			return fmt.Errorf("invalid intensity %g of light %d", light.Intensity, i+1)
+		}
+		if light.ConeAngle <= 0 || light.ConeAngle >= 90 || light.Falloff < 0 || light.Falloff > 1 {
+			return fmt.Errorf("invalid spot cone of light %d", i+1)
+		}
+		if light.Attenuation[0] <= 0 || light.Attenuation[1] < 0 || light.Attenuation[2] < 0 {
+			return fmt.Errorf("invalid attenuation of light %d", i+1)
+		}
+		lights[i] = &Light{
+			kind:        light.Type,
+			x:           light.X,
+			y:           light.Y,
+			height:      light.Height,
+			color:       draw.RGBAToColor(light.ColorRGBA),
+			intensity:   light.Intensity,
+			enabled:     light.Enabled,
+			coneAngle:   light.ConeAngle,
+			falloff:     light.Falloff,
+			attenuation: light.Attenuation,
+		}
+	}
+
+	var backgroundImage, normalMap image.Image
+	backgroundImagePath := scenefile.ResolvePath(path, file.Background.ImagePath)
+	if backgroundImagePath != "" {
+		var err error
+		backgroundImage, err = getImageFromFilePath(backgroundImagePath)
+		if err != nil {
+			return err
+		}
+	}
+	var environment *environment
+	environmentPath := scenefile.ResolvePath(path, file.Environment.ImagePath)
+	if environmentPath != "" {
+		var err error
+		environment, err = loadEnvironment(environmentPath)
+		if err != nil {
+			return err
+		}
+	}
+	normalMapPath := scenefile.ResolvePath(path, file.Material.NormalMapPath)
+	if normalMapPath != "" {
+		var err error
+		normalMap, err = getImageFromFilePath(normalMapPath)
+		if err != nil {
+			return err
+		}
+	}
+	// surface images are only decoded here, surfaces are changed with the
+	// rest of scene
+	surfaceImages := map[string]image.Image{}
+	surfacePaths := map[string]string{}
+	for name, file := range surface.Files {
+		if _, ok := s.surfaces[name].(FileSurface); !ok {
+			return fmt.Errorf("surface %q isn't loaded from file", name)
+		}
+		surfacePaths[name] = scenefile.ResolvePath(path, file)
+		img, err := getImageFromFilePath(surfacePaths[name])
+		if err != nil {
+			return err
+		}
+		surfaceImages[name] = img
+	}
+
+	points := make([][]*geom.Point, size)
+	for i := range surface.Points {
+		points[i] = make([]*geom.Point, size)
+		for j, point := range surface.Points[i] {
+			points[i][j] = geom.NewPoint(point[0], point[1])
+		}
+	}
+
+	for name, img := range surfaceImages {
+		s.surfaces[name].(FileSurface).SetImage(surfacePaths[name], img)
+	}
+	setParams(s.surfaces, surface.Params)
+	setParams(s.brdfs, file.Material.Params)
+	s.lights = lights
+	s.LightAnimation = file.LightAnimation
+	s.shadows = file.Shadows.Enabled
+	s.shadowBias = file.Shadows.Bias
+	s.shadowLightRadius = file.Shadows.LightRadius
+	s.shadowSamples = file.Shadows.Samples
+	s.ao = ao.Enabled
+	s.aoRadius = ao.Radius
+	s.aoSamples = ao.Samples
+	s.aoStrength = ao.Strength
+	s.environment = environment
+	s.environmentPath = environmentPath
+	s.environmentIntensity = file.Environment.Intensity
+	s.environmentRotation = file.Environment.Rotation
+	s.kd = file.Material.Kd
+	s.ks = file.Material.Ks
+	s.m = file.Material.M
+	s.ka = file.Material.Ka
+	s.ambientColor = draw.RGBAToColor(file.Material.AmbientColorRGBA)
+	s.brdf = file.Material.BRDF
+	s.normalMap = normalMap
+	s.normalMapPath = normalMapPath
+	s.isBackgroundSolidColor = file.Background.IsSolidColor
+	s.backgroundSolidColor = draw.RGBAToColor(file.Background.SolidColorRGBA)
+	s.backgroundImage = backgroundImage
+	s.backgroundImagePath = backgroundImagePath
+	s.surface = surface.Type
+	s.patchDegree = surface.PatchDegree
+	s.continuity = surface.Continuity
+	s.splineDegree = surface.SplineDegree
+	s.knotsU = surface.KnotsU
+	s.knotsV = surface.KnotsV
+	s.points = points
+	s.pointsHeight = surface.PointsHeight
+	s.pointsWeight = surface.PointsWeight
+	s.triangulation = file.View.Triangulation
+	s.showMesh = file.View.ShowMesh
+	s.alpha = file.View.Alpha
+	s.beta = file.View.Beta
+	s.projection = file.View.Projection
+	s.fov = file.View.FOV
+	s.zoom = file.View.Zoom
+	s.pan = Vec{file.View.Pan[0], file.View.Pan[1], file.View.Pan[2]}
+	s.shading = file.View.Shading
+	s.toneMapping = file.View.ToneMapping
+	s.exposure = file.View.Exposure
+	s.gamma = file.View.Gamma
+	s.triangles = makeTriangles(s.points, s.patchDegree, s.triangulation)
+	return nil
+}
+
+// Whether value is within range from min to max, NaN never is
+func inRange(value, min, max float64) bool {
+	return value >= min && value <= max
+}
+
+// Check that values of params of configurable surfaces or reflectance models
+// are within ranges of params
+func checkParams[T any](items map[string]T, values map[string]map[string]float64) error {
+	for name, itemValues := range values {
+		configurable, ok := any(items[name]).(Configurable)
+		if !ok {
+			continue
+		}
+		for _, param := range configurable.Params() {
+			if value, ok := itemValues[param.Name]; ok && !inRange(value, param.Min, param.Max) {
+				return fmt.Errorf("invalid %s %g of %q", param.Name, value, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Set params of configurable surfaces or reflectance models by name, values
+// missing in file are left unchanged
+func setParams[T any](items map[string]T, values map[string]map[string]float64) {
+	for name, itemValues := range values {
+		configurable, ok := any(items[name]).(Configurable)
+		if !ok {
+			continue
+		}
+		for _, param := range configurable.Params() {
+			if value, ok := itemValues[param.Name]; ok {
+				*param.Value = value
+			}
+		}
+	}
+}
+
+// Limits of triangulation, finer one takes too long to render
+const (
+	triangulationMin = 2
+	triangulationMax = 29
+)
+
+// Triangulate surface in parametric space, every cell of control points grid
+// is split into triangulation x triangulation squares made of two triangles.
+// Vertices are mapped onto raster with planePoint, so triangles follow
+// control points moved out of regular grid.
+func makeTriangles(points [][]*geom.Point, degree, triangulation int) []*geom.Triangle {
+	rows := (len(points) - 1) * triangulation
+	cols := (len(points[0]) - 1) * triangulation
+
+	uvs := make([][]*geom.Point, rows+1)
+	vertices := make([][]*geom.Point, rows+1)
+	for m := 0; m <= rows; m++ {
+		uvs[m] = make([]*geom.Point, cols+1)
+		vertices[m] = make([]*geom.Point, cols+1)
+		for n := 0; n <= cols; n++ {
+			uvs[m][n] = geom.NewPoint(float64(m)/float64(rows), float64(n)/float64(cols))
+			vertices[m][n] = planePoint(uvs[m][n].X, uvs[m][n].Y, points, degree)
+		}
+	}
+
+	triangles := []*geom.Triangle{}
+	for m := 0; m < rows; m++ {
+		for n := 0; n < cols; n++ {
+			triangles = append(triangles,
+				geom.NewTriangleUV(
+					vertices[m][n], vertices[m+1][n], vertices[m][n+1],
+					uvs[m][n], uvs[m+1][n], uvs[m][n+1],
+				),
+				geom.NewTriangleUV(
+					vertices[m+1][n], vertices[m+1][n+1], vertices[m][n+1],
+					uvs[m+1][n], uvs[m+1][n+1], uvs[m][n+1],
+				),
+			)
+		}
+	}
+	return triangles
+}
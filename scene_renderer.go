@@ -0,0 +1,190 @@
+package main
+
+import (
+	"image"
+	"runtime"
+	"sync"
+
+	"github.com/zeraye/bezier-shading/pkg/draw"
+	"github.com/zeraye/bezier-shading/pkg/geom"
+	"github.com/zeraye/bezier-shading/pkg/hdr"
+)
+
+// Shading models, lighting is computed once per triangle, at its vertices or
+// at every pixel
+const (
+	shadingFlat = iota
+	shadingGouraud
+	shadingPhong
+)
+
+// Buffers which can be shown instead of shaded image, for debugging
+const (
+	debugViewShaded = iota
+	debugViewDepth
+	debugViewAO
+)
+
+// Side of square tiles if it isn't set in config
+const defaultRenderTileSize = 32
+
+// Render shaded scene into width x height image as seen by scene camera
+func (s *Scene) Render(width, height int) *image.RGBA {
+	return s.resolve(s.renderBuffer(width, height, false))
+}
+
+// Render scene like Render, but into linear light of pixels before it is
+// tone mapped and quantized
+func (s *Scene) RenderHDR(width, height int) *hdr.Image {
+	buffer := s.renderBuffer(width, height, true)
+	if s.debugView == debugViewDepth {
+		return imageRadiance(buffer.DepthImage())
+	}
+	return buffer.Radiance()
+}
+
+// Render scene into depth buffer, which keeps radiance if keepRadiance is
+// true. Image is split into tiles filled by pool of workers, every tile by
+// single worker with polygons overlapping it, so no pixel is written
+// concurrently.
+func (s *Scene) renderBuffer(width, height int, keepRadiance bool) *draw.DepthBuffer {
+	background := draw.RGBAToColor(s.config.UI.BackgroundColorRGBA)
+	buffer := draw.NewDepthBuffer(width, height, background)
+	if keepRadiance {
+		buffer.KeepRadiance(background)
+	}
+	cam := s.camera(width, height)
+	surface := s.evalTriangles()
+	heights := s.renderHeightField(surface)
+
+	polygons := make([]*projectedPolygon, len(s.triangles))
+	parallel(len(s.triangles), func(i int) {
+		tri := s.triangles[i]
+		polygons[i] = projectPolygon([]*geom.Point{tri.P0, tri.P1, tri.P2}, surface[i][:], s, cam, heights)
+	})
+
+	tileSize := s.config.UI.RenderTileSize
+	if tileSize <= 0 {
+		tileSize = defaultRenderTileSize
+	}
+	columns := (width + tileSize - 1) / tileSize
+	rows := (height + tileSize - 1) / tileSize
+	tiles := make([][]*projectedPolygon, columns*rows)
+	for _, polygon := range polygons {
+		if polygon == nil {
+			continue
+		}
+		bounds := polygon.bounds(buffer.Bounds())
+		if bounds.Empty() {
+			continue
+		}
+		for row := bounds.Min.Y / tileSize; row <= (bounds.Max.Y-1)/tileSize; row++ {
+			for column := bounds.Min.X / tileSize; column <= (bounds.Max.X-1)/tileSize; column++ {
+				tiles[row*columns+column] = append(tiles[row*columns+column], polygon)
+			}
+		}
+	}
+
+	parallel(len(tiles), func(i int) {
+		row, column := i/columns, i%columns
+		clip := image.Rect(column*tileSize, row*tileSize, (column+1)*tileSize, (row+1)*tileSize).Intersect(buffer.Bounds())
+		for _, polygon := range tiles[i] {
+			polygon.fill(s.backgroundSolidColor, buffer, s, cam, heights, clip)
+		}
+	})
+
+	return buffer
+}
+
+// Surface evaluated at vertices of every triangle. Vertices are shared by
+// neighbouring triangles, so surface is evaluated once at every one of them,
+// on GOMAXPROCS workers.
+func (s *Scene) evalTriangles() [][3]SurfacePoint {
+	type vertex struct {
+		point *geom.Point
+		uv    *geom.Point
+	}
+	index := map[vertex]int{}
+	vertices := []vertex{}
+	triangleVertices := make([][3]int, len(s.triangles))
+	for i, tri := range s.triangles {
+		for k, v := range [3]vertex{{tri.P0, tri.UV0}, {tri.P1, tri.UV1}, {tri.P2, tri.UV2}} {
+			j, ok := index[v]
+			if !ok {
+				j = len(vertices)
+				index[v] = j
+				vertices = append(vertices, v)
+			}
+			triangleVertices[i][k] = j
+		}
+	}
+
+	surface := s.surfaces[s.surface]
+	evaluated := make([]SurfacePoint, len(vertices))
+	parallel(len(vertices), func(i int) {
+		v := vertices[i]
+		evaluated[i] = surface.Eval(s, v.point.X, v.point.Y, v.uv.X, v.uv.Y)
+	})
+
+	triangles := make([][3]SurfacePoint, len(s.triangles))
+	for i, t := range triangleVertices {
+		triangles[i] = [3]SurfacePoint{evaluated[t[0]], evaluated[t[1]], evaluated[t[2]]}
+	}
+	return triangles
+}
+
+// Heightfield of surface, evaluated at vertices of triangles, casting
+// shadows and occluding ambient light, nil if both are turned off
+func (s *Scene) renderHeightField(surface [][3]SurfacePoint) *heightField {
+	if !s.shadows && !s.ao {
+		return nil
+	}
+	return s.heightField(surface)
+}
+
+// Image shown for rendered buffer, depending on debug view
+func (s *Scene) resolve(buffer *draw.DepthBuffer) *image.RGBA {
+	if s.debugView == debugViewDepth {
+		return buffer.DepthImage()
+	}
+	return buffer.Image()
+}
+
+// Call work for every index from 0 to n-1 on GOMAXPROCS workers
+func parallel(n int, work func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	workers := runtime.GOMAXPROCS(0)
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				work(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Render scene into width x height image, every pixel is average of samples x
+// samples rendered pixels. Result has 16 bits per channel if samples > 1.
+func (s *Scene) RenderSupersampled(width, height, samples int) image.Image {
+	if samples <= 1 {
+		return s.Render(width, height)
+	}
+	return draw.Downsample(s.Render(width*samples, height*samples), samples)
+}
+
+// Render scene into linear light of width x height pixels, every pixel is
+// average of samples x samples rendered pixels
+func (s *Scene) RenderHDRSupersampled(width, height, samples int) *hdr.Image {
+	if samples <= 1 {
+		return s.RenderHDR(width, height)
+	}
+	return hdr.Downsample(s.RenderHDR(width*samples, height*samples), samples)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"image"
+	"sync"
+	"testing"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+	"github.com/zeraye/bezier-shading/pkg/draw"
+	"github.com/zeraye/bezier-shading/pkg/geom"
+)
+
+// Triangulation of benchmarked scene, the finest one of the slider
+const benchTriangulation = 29
+
+// Default scene with fine triangulation. Shadows and ambient occlusion are
+// turned off, time of building their heightfield doesn't depend on renderer.
+func newBenchScene(b *testing.B) *Scene {
+	config, err := config.LoadStandard("config", "config.toml")
+	if err != nil {
+		b.Fatal(err)
+	}
+	s := NewScene(config)
+	s.shadows = false
+	s.ao = false
+	s.triangulation = benchTriangulation
+	s.triangles = makeTriangles(s.points, s.patchDegree, s.triangulation)
+	return s
+}
+
+func benchmarkRender(b *testing.B, render func(s *Scene, width, height int) *image.RGBA) {
+	s := newBenchScene(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		render(s, s.config.UI.RasterWidth, s.config.UI.RasterHeight)
+	}
+}
+
+func BenchmarkRenderTiles(b *testing.B) {
+	benchmarkRender(b, (*Scene).Render)
+}
+
+func BenchmarkRenderPerTriangle(b *testing.B) {
+	benchmarkRender(b, renderPerTriangle)
+}
+
+// Render scene the way it was done before tiles, with goroutine per triangle
+// evaluating surface at its vertices and writing to whole image, kept to
+// compare renderers
+func renderPerTriangle(s *Scene, width, height int) *image.RGBA {
+	buffer := draw.NewDepthBuffer(width, height, draw.RGBAToColor(s.config.UI.BackgroundColorRGBA))
+	cam := s.camera(width, height)
+	// heightfield needs surface at all vertices before any triangle is lit
+	var heights *heightField
+	if s.shadows || s.ao {
+		heights = s.heightField(s.evalTriangles())
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(s.triangles))
+	for _, tri := range s.triangles {
+		go func(tri *geom.Triangle) {
+			defer wg.Done()
+			points := []*geom.Point{tri.P0, tri.P1, tri.P2}
+			uvs := []*geom.Point{tri.UV0, tri.UV1, tri.UV2}
+			surface := make([]SurfacePoint, len(points))
+			for i, p := range points {
+				surface[i] = s.surfaces[s.surface].Eval(s, p.X, p.Y, uvs[i].X, uvs[i].Y)
+			}
+			polygon := projectPolygon(points, surface, s, cam, heights)
+			if polygon != nil {
+				polygon.fill(s.backgroundSolidColor, buffer, s, cam, heights, buffer.Bounds())
+			}
+		}(tri)
+	}
+	wg.Wait()
+
+	return s.resolve(buffer)
+}
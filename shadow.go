@@ -0,0 +1,67 @@
+package main
+
+import "math"
+
+// Angle between consecutive samples of spiral, which spreads them evenly
+var goldenAngle = math.Pi * (3 - math.Sqrt(5))
+
+// Whether ray from p in normalized direction l hits surface before distance
+// maxDist. Ray is marched one cell at a time, surface has to be higher than
+// ray by more than bias to block it, so that surface doesn't shadow itself.
+func (f *heightField) occluded(p, l Vec, maxDist, bias float64) bool {
+	horizontal := math.Hypot(l.x, l.y)
+	if horizontal < 1e-9 {
+		// ray goes straight up or down, only surface below p is crossed
+		return false
+	}
+	step := heightFieldCell / horizontal
+	for t := step; t < maxDist; t += step {
+		q := add(p, mult(t, l))
+		if l.z >= 0 && q.z > f.max+bias {
+			return false
+		}
+		height, ok := f.at(q.x, q.y)
+		if !ok {
+			// ray left raster and can't come back over it
+			return false
+		}
+		if height > q.z+bias {
+			return true
+		}
+	}
+	return false
+}
+
+// Fraction (0-1) of light reaching scene point p without being blocked by
+// surface. With shadow light radius above 0 light is sampled at points of
+// horizontal disk around it, so that shadows have soft edges.
+func (s *Scene) lightVisibility(heights *heightField, light *Light, p Vec) float64 {
+	if heights == nil || !s.shadows {
+		return 1
+	}
+	samples := 1
+	if s.shadowLightRadius > 0 {
+		samples = max(1, s.shadowSamples)
+	}
+
+	visible := 0
+	for i := 0; i < samples; i++ {
+		position := light.position()
+		if samples > 1 {
+			r := s.shadowLightRadius * math.Sqrt((float64(i)+0.5)/float64(samples))
+			angle := float64(i) * goldenAngle
+			position.x += r * math.Cos(angle)
+			position.y += r * math.Sin(angle)
+		}
+		l := minus(position, p)
+		maxDist := magnitude(l)
+		if light.kind == lightTypeDirectional {
+			l = minus(position, s.lightTarget())
+			maxDist = math.Inf(1)
+		}
+		if !heights.occluded(p, normalize(l), maxDist, s.shadowBias) {
+			visible++
+		}
+	}
+	return float64(visible) / float64(samples)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+)
+
+// Sample of surface at a raster point
+type SurfacePoint struct {
+	Z      float64 // height of surface
+	Normal Vec     // normalized normal vector
+	U, V   float64 // parametric coordinates (0-1)
+}
+
+type Surface interface {
+	// Sample surface at raster point (x, y) with parametric coordinates
+	// (u, v), which differ from raster ones when control points are moved
+	Eval(scene *Scene, x, y, u, v float64) SurfacePoint
+}
+
+// Implemented by surfaces loaded from image file chosen by user. Image is
+// decoded by caller, so that it can be checked before surface is changed.
+type FileSurface interface {
+	SetImage(path string, img image.Image)
+	FilePath() string // path of loaded file, empty if none
+}
+
+type surfaceEntry struct {
+	name       string
+	label      string
+	newSurface func(config *config.Config) Surface
+}
+
+// Registered surface types, in order of registration
+var surfaceRegistry = []surfaceEntry{}
+
+// Register new surface type, name is used internally, label is shown in menu.
+// Should be called from init function of file implementing the surface.
+func RegisterSurface(name, label string, newSurface func(config *config.Config) Surface) {
+	for _, entry := range surfaceRegistry {
+		if entry.name == name {
+			panic("Surface " + name + " is already registered")
+		}
+	}
+	surfaceRegistry = append(surfaceRegistry, surfaceEntry{name, label, newSurface})
+}
+
+// Create instance of every registered surface type
+func newSurfaces(config *config.Config) map[string]Surface {
+	surfaces := map[string]Surface{}
+	for _, entry := range surfaceRegistry {
+		surfaces[entry.name] = entry.newSurface(config)
+	}
+	return surfaces
+}
@@ -0,0 +1,58 @@
+package main
+
+import "github.com/zeraye/bezier-shading/pkg/config"
+
+func init() {
+	RegisterSurface("bezier", "Bezier", func(_ *config.Config) Surface { return &bezierSurface{} })
+	RegisterSurface("bspline", "B-spline", func(_ *config.Config) Surface { return &nurbsSurface{rational: false} })
+	RegisterSurface("nurbs", "NURBS", func(_ *config.Config) Surface { return &nurbsSurface{rational: true} })
+}
+
+// Surface made of Bezier patches spanned on scene control points
+type bezierSurface struct{}
+
+func (s *bezierSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	ndu := patchesBezierDU(u, v, scene.pointsHeight, scene.patchDegree)
+	ndv := patchesBezierDV(u, v, scene.pointsHeight, scene.patchDegree)
+	return SurfacePoint{
+		Z:      patchesBezier(u, v, scene.pointsHeight, scene.patchDegree).z,
+		Normal: scene.planeNormal(u, v, ndu.z, ndv.z),
+		U:      u,
+		V:      v,
+	}
+}
+
+// B-spline (or NURBS if rational) surface spanned on scene control points
+type nurbsSurface struct {
+	rational bool
+}
+
+func (s *nurbsSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	pointsWeight := scene.pointsWeight
+	if !s.rational {
+		pointsWeight = nil
+	}
+	p, ndu, ndv := nurbs(u, v, scene.pointsHeight, pointsWeight, scene.knotsU, scene.knotsV, scene.splineDegree)
+	return SurfacePoint{
+		Z:      p.z,
+		Normal: scene.planeNormal(u, v, ndu.z, ndv.z),
+		U:      u,
+		V:      v,
+	}
+}
+
+// Whether active surface is B-spline or NURBS. They are smooth by themselves
+// and moving a control point has to change them only near it, so no other
+// points are moved to keep continuity between patches.
+func (s *Scene) splineSurface() bool {
+	_, ok := s.surfaces[s.surface].(*nurbsSurface)
+	return ok
+}
+
+// Continuity kept between Bezier patches when control points are moved
+func (s *Scene) editContinuity() int {
+	if s.splineSurface() {
+		return continuityC0
+	}
+	return s.continuity
+}
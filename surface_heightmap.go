@@ -0,0 +1,91 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+)
+
+func init() {
+	RegisterSurface("heightmap", "Heightmap", func(config *config.Config) Surface {
+		return &heightMapSurface{scale: config.Defaults.HeightMapScale}
+	})
+}
+
+// Surface with heights read from grayscale image (e.g. DEM tile), flat
+// until image is loaded
+type heightMapSurface struct {
+	path    string
+	width   int
+	height  int
+	heights []float64 // grayscale values (0-1), row by row
+	scale   float64   // vertical scale
+}
+
+func (s *heightMapSurface) SetImage(path string, img image.Image) {
+	s.path = path
+	bounds := img.Bounds()
+	s.width = bounds.Dx()
+	s.height = bounds.Dy()
+	s.heights = make([]float64, s.width*s.height)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			// 16-bit gray keeps precision of 16-bit DEM tiles
+			gray := color.Gray16Model.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray16)
+			s.heights[y*s.width+x] = float64(gray.Y) / 0xffff
+		}
+	}
+}
+
+func (s *heightMapSurface) FilePath() string {
+	return s.path
+}
+
+func (s *heightMapSurface) Params() []Param {
+	return []Param{{Name: "vertical scale", Min: 0, Max: 5, Step: 0.05, Value: &s.scale}}
+}
+
+// Height at image pixel coordinates, clamped to image borders
+func (s *heightMapSurface) pixel(x, y int) float64 {
+	x = max(0, min(x, s.width-1))
+	y = max(0, min(y, s.height-1))
+	return s.heights[y*s.width+x]
+}
+
+// Height at (u, v) bilinearly interpolated between pixels
+func (s *heightMapSurface) heightAt(u, v float64) float64 {
+	x := u * float64(s.width-1)
+	y := v * float64(s.height-1)
+	x0 := math.Floor(x)
+	y0 := math.Floor(y)
+	tx := x - x0
+	ty := y - y0
+	h00 := s.pixel(int(x0), int(y0))
+	h10 := s.pixel(int(x0)+1, int(y0))
+	h01 := s.pixel(int(x0), int(y0)+1)
+	h11 := s.pixel(int(x0)+1, int(y0)+1)
+	top := h00*(1-tx) + h10*tx
+	bottom := h01*(1-tx) + h11*tx
+	return (top*(1-ty) + bottom*ty) * s.scale
+}
+
+func (s *heightMapSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	if s.heights == nil {
+		return SurfacePoint{Z: 0, Normal: Vec{0, 0, 1}, U: u, V: v}
+	}
+
+	// central differences with step of one image pixel
+	du := 1 / float64(max(s.width-1, 1))
+	dv := 1 / float64(max(s.height-1, 1))
+	zu := (s.heightAt(u+du, v) - s.heightAt(u-du, v)) / (2 * du)
+	zv := (s.heightAt(u, v+dv) - s.heightAt(u, v-dv)) / (2 * dv)
+
+	return SurfacePoint{
+		Z:      s.heightAt(u, v),
+		Normal: normalize(crossProduct(Vec{1, 0, zu}, Vec{0, 1, zv})),
+		U:      u,
+		V:      v,
+	}
+}
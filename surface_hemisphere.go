@@ -0,0 +1,32 @@
+package main
+
+import (
+	"math"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+)
+
+func init() {
+	RegisterSurface("hemisphere", "Hemisphere", func(_ *config.Config) Surface { return &hemisphereSurface{} })
+}
+
+// Hemisphere inscribed in raster, flat outside of it
+type hemisphereSurface struct{}
+
+func (s *hemisphereSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	width := float64(scene.config.UI.RasterWidth)
+	r := width / 2
+	if math.Pow(x-r, 2)+math.Pow(-y+r, 2) < math.Pow(r, 2) {
+		z := math.Sqrt(
+			math.Pow(0.5, 2) -
+				math.Pow(x/width-0.5, 2) -
+				math.Pow(y/width-0.5, 2))
+		return SurfacePoint{
+			Z:      z,
+			Normal: normalize(Vec{x/width - 0.5, y/width - 0.5, z}),
+			U:      u,
+			V:      v,
+		}
+	}
+	return SurfacePoint{Z: 0, Normal: normalize(Vec{0, 0, 1}), U: u, V: v}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"math"
+	"sync"
+
+	"github.com/zeraye/bezier-shading/pkg/config"
+	"github.com/zeraye/bezier-shading/pkg/noise"
+)
+
+func init() {
+	RegisterSurface("torus", "Torus cap", func(_ *config.Config) Surface {
+		return &torusSurface{majorRadius: 0.3, minorRadius: 0.15}
+	})
+	RegisterSurface("ripples", "Ripples", func(_ *config.Config) Surface {
+		return &ripplesSurface{amplitude: 0.1, frequency: 5}
+	})
+	RegisterSurface("saddle", "Saddle", func(_ *config.Config) Surface {
+		return &saddleSurface{curvature: 2}
+	})
+	RegisterSurface("gaussian", "Gaussian bumps", func(_ *config.Config) Surface {
+		return &gaussianSurface{bumpsPerSide: 3, amplitude: 0.5, width: 0.08}
+	})
+	RegisterSurface("noise", "Noise terrain", func(_ *config.Config) Surface {
+		return &noiseSurface{amplitude: 0.1, frequency: 4, octaves: 4, persistence: 0.5, seed: 0}
+	})
+}
+
+// Surface point with height z and partial derivatives zu, zv in parametric
+// coordinates (u, v)
+func heightSurfacePoint(u, v, z, zu, zv float64) SurfacePoint {
+	return SurfacePoint{
+		Z:      z,
+		Normal: normalize(Vec{-zu, -zv, 1}),
+		U:      u,
+		V:      v,
+	}
+}
+
+// Upper half of torus lying in the middle of raster
+type torusSurface struct {
+	majorRadius float64
+	minorRadius float64
+}
+
+func (s *torusSurface) Params() []Param {
+	return []Param{
+		{Name: "major radius", Min: 0.05, Max: 0.5, Step: 0.01, Value: &s.majorRadius},
+		{Name: "minor radius", Min: 0.01, Max: 0.25, Step: 0.01, Value: &s.minorRadius},
+	}
+}
+
+func (s *torusSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	cu := u - 0.5
+	cv := v - 0.5
+	d := math.Hypot(cu, cv)
+	// signed distance from tube centre circle
+	t := d - s.majorRadius
+	if d == 0 || math.Abs(t) >= s.minorRadius {
+		return heightSurfacePoint(u, v, 0, 0, 0)
+	}
+	z := math.Sqrt(s.minorRadius*s.minorRadius - t*t)
+	// normal of tube points away from tube centre circle, it is well
+	// defined even at the tube rim where height derivatives are infinite
+	return SurfacePoint{
+		Z:      z,
+		Normal: normalize(Vec{t * cu / d, t * cv / d, z}),
+		U:      u,
+		V:      v,
+	}
+}
+
+// Concentric sinusoidal ripples around middle of raster
+type ripplesSurface struct {
+	amplitude float64
+	frequency float64
+}
+
+func (s *ripplesSurface) Params() []Param {
+	return []Param{
+		{Name: "amplitude", Min: 0, Max: 0.5, Step: 0.01, Value: &s.amplitude},
+		{Name: "frequency", Min: 1, Max: 20, Step: 0.5, Value: &s.frequency},
+	}
+}
+
+func (s *ripplesSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	cu := u - 0.5
+	cv := v - 0.5
+	d := math.Hypot(cu, cv)
+	k := 2 * math.Pi * s.frequency
+	z := s.amplitude * math.Cos(k*d)
+	if d == 0 {
+		return heightSurfacePoint(u, v, z, 0, 0)
+	}
+	dz := -s.amplitude * k * math.Sin(k*d)
+	return heightSurfacePoint(u, v, z, dz*cu/d, dz*cv/d)
+}
+
+// Hyperbolic paraboloid z = c(u^2 - v^2) centred in the middle of raster
+type saddleSurface struct {
+	curvature float64
+}
+
+func (s *saddleSurface) Params() []Param {
+	return []Param{
+		{Name: "curvature", Min: -5, Max: 5, Step: 0.1, Value: &s.curvature},
+	}
+}
+
+func (s *saddleSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	cu := u - 0.5
+	cv := v - 0.5
+	z := s.curvature * (cu*cu - cv*cv)
+	return heightSurfacePoint(u, v, z, 2*s.curvature*cu, -2*s.curvature*cv)
+}
+
+// Regular grid of Gaussian bumps
+type gaussianSurface struct {
+	bumpsPerSide float64
+	amplitude    float64
+	width        float64 // standard deviation of single bump
+}
+
+func (s *gaussianSurface) Params() []Param {
+	return []Param{
+		{Name: "bumps per side", Min: 1, Max: 6, Step: 1, Value: &s.bumpsPerSide},
+		{Name: "amplitude", Min: -1, Max: 1, Step: 0.05, Value: &s.amplitude},
+		{Name: "width", Min: 0.01, Max: 0.3, Step: 0.01, Value: &s.width},
+	}
+}
+
+func (s *gaussianSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	bumps := int(s.bumpsPerSide)
+	z, zu, zv := 0.0, 0.0, 0.0
+	for i := 0; i < bumps; i++ {
+		for j := 0; j < bumps; j++ {
+			du := u - (float64(i)+0.5)/float64(bumps)
+			dv := v - (float64(j)+0.5)/float64(bumps)
+			bump := s.amplitude * math.Exp(-(du*du+dv*dv)/(2*s.width*s.width))
+			z += bump
+			zu -= bump * du / (s.width * s.width)
+			zv -= bump * dv / (s.width * s.width)
+		}
+	}
+	return heightSurfacePoint(u, v, z, zu, zv)
+}
+
+// Terrain made of fractal Perlin noise
+type noiseSurface struct {
+	amplitude   float64
+	frequency   float64
+	octaves     float64
+	persistence float64
+	seed        float64
+	perlin      *noise.Perlin
+	perlinSeed  float64 // seed perlin was created with
+	perlinMutex sync.Mutex
+}
+
+func (s *noiseSurface) Params() []Param {
+	return []Param{
+		{Name: "amplitude", Min: 0, Max: 1, Step: 0.05, Value: &s.amplitude},
+		{Name: "frequency", Min: 1, Max: 16, Step: 0.5, Value: &s.frequency},
+		{Name: "octaves", Min: 1, Max: 8, Step: 1, Value: &s.octaves},
+		{Name: "persistence", Min: 0, Max: 1, Step: 0.05, Value: &s.persistence},
+		{Name: "seed", Min: 0, Max: 100, Step: 1, Value: &s.seed},
+	}
+}
+
+func (s *noiseSurface) Eval(scene *Scene, x, y, u, v float64) SurfacePoint {
+	s.perlinMutex.Lock()
+	if s.perlin == nil || s.perlinSeed != s.seed {
+		s.perlin = noise.NewPerlin(int64(s.seed))
+		s.perlinSeed = s.seed
+	}
+	perlin := s.perlin
+	s.perlinMutex.Unlock()
+	n, nu, nv := perlin.Fractal2(u*s.frequency, v*s.frequency, int(s.octaves), s.persistence)
+	return heightSurfacePoint(u, v, s.amplitude*n, s.amplitude*s.frequency*nu, s.amplitude*s.frequency*nv)
+}
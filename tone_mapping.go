@@ -0,0 +1,43 @@
+package main
+
+import (
+	"image/color"
+	"math"
+)
+
+// Tone mapping operators, compressing linear light of any brightness into
+// range of image
+const (
+	toneMappingClamp = iota
+	toneMappingReinhard
+	toneMappingACES
+)
+
+// Relative luminance of linear light
+func luminance(c Vec) float64 {
+	return 0.2126*c.x + 0.7152*c.y + 0.0722*c.z
+}
+
+// Color of pixel showing linear light c. Light is scaled by 2^exposure,
+// tone mapped, clamped to 0-1 and gamma encoded.
+func (s *Scene) toneMap(c Vec) color.RGBA {
+	c = mult(math.Exp2(s.exposure), c)
+	switch s.toneMapping {
+	case toneMappingReinhard:
+		// applied to luminance, so that hue of bright light is kept
+		if l := luminance(c); l > 0 {
+			c = mult(1/(1+l), c)
+		}
+	case toneMappingACES:
+		// Narkowicz fit of ACES filmic curve
+		aces := func(x float64) float64 {
+			return x * (2.51*x + 0.03) / (x*(2.43*x+0.59) + 0.14)
+		}
+		c = Vec{aces(c.x), aces(c.y), aces(c.z)}
+	}
+	encode := func(v float64) uint8 {
+		v = math.Max(0, math.Min(v, 1))
+		return uint8(math.Pow(v, 1/s.gamma)*255 + 0.5)
+	}
+	return color.RGBA{encode(c.x), encode(c.y), encode(c.z), 255}
+}
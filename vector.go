@@ -48,6 +48,14 @@ func mult(scalar float64, vec Vec) Vec {
 	return Vec{vec.x * scalar, vec.y * scalar, vec.z * scalar}
 }
 
+func add(vec0, vec1 Vec) Vec {
+	return Vec{
+		vec0.x + vec1.x,
+		vec0.y + vec1.y,
+		vec0.z + vec1.z,
+	}
+}
+
 func add3(vec0, vec1, vec2 Vec) Vec {
 	return Vec{
 		vec0.x + vec1.x + vec2.x,
@@ -68,37 +76,47 @@ func b(i, n int, t float64) float64 {
 	return float64(combin.Binomial(n, i)) * math.Pow(t, float64(i)) * math.Pow(1-t, float64(n-i))
 }
 
+// Evaluate Bezier surface of degree (n, m) at (u, v), where pointsHeight is
+// (n+1)x(m+1) grid of control points heights
 func bezier(u, v float64, pointsHeight [][]float64) Vec {
+	n := len(pointsHeight) - 1
+	m := len(pointsHeight[0]) - 1
 	z := 0.0
-	for i := 0; i < 4; i++ {
-		for j := 0; j < 4; j++ {
-			z += (pointsHeight[i][j] / 100) * b(i, 3, u) * b(j, 3, v)
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= m; j++ {
+			z += (pointsHeight[i][j] / 100) * b(i, n, u) * b(j, m, v)
 		}
 	}
 	vec := Vec{u, v, z}
 	return vec
 }
 
+// Partial derivative of Bezier surface with respect to u
 func bezierDU(u, v float64, pointsHeight [][]float64) Vec {
+	n := len(pointsHeight) - 1
+	m := len(pointsHeight[0]) - 1
 	z := 0.0
-	for i := 0; i <= 2; i++ {
-		for j := 0; j <= 3; j++ {
-			z += (pointsHeight[i+1][j]/100 - pointsHeight[i][j]/100) * b(i, 2, u) * b(j, 3, v)
+	for i := 0; i <= n-1; i++ {
+		for j := 0; j <= m; j++ {
+			z += (pointsHeight[i+1][j]/100 - pointsHeight[i][j]/100) * b(i, n-1, u) * b(j, m, v)
 		}
 	}
-	z *= 3
+	z *= float64(n)
 	vec := Vec{1, 0, z}
 	return vec
 }
 
+// Partial derivative of Bezier surface with respect to v
 func bezierDV(u, v float64, pointsHeight [][]float64) Vec {
+	n := len(pointsHeight) - 1
+	m := len(pointsHeight[0]) - 1
 	z := 0.0
-	for i := 0; i <= 3; i++ {
-		for j := 0; j <= 2; j++ {
-			z += (pointsHeight[i][j+1]/100 - pointsHeight[i][j]/100) * b(i, 3, u) * b(j, 2, v)
+	for i := 0; i <= n; i++ {
+		for j := 0; j <= m-1; j++ {
+			z += (pointsHeight[i][j+1]/100 - pointsHeight[i][j]/100) * b(i, n, u) * b(j, m-1, v)
 		}
 	}
-	z *= 3
+	z *= float64(m)
 	vec := Vec{0, 1, z}
 	return vec
 }